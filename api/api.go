@@ -0,0 +1,406 @@
+/*
+Package api implements HTTP control API of daemon, e.g. for "back up now"
+button of internal portal. Every request must be authenticated by bearer
+token:
+
+	Authorization: Bearer <API_TOKEN>
+
+Endpoints, job name is path escaped:
+
+	GET  /api/v1/jobs: list jobs with schedule and the last run state
+	GET  /api/v1/jobs/{job}: job with schedule and the last run state
+	POST /api/v1/jobs/{job}/run: start job run now
+	GET  /api/v1/jobs/{job}/progress: live progress of the job run
+	GET  /api/v1/jobs/{job}/backups: backup files saved in job storages
+	GET  /api/v1/jobs/{job}/runs: finished job runs, the latest first,
+	     query parameters: limit (default 50) and outcome
+
+Responses are JSON. Errors are JSON objects with error field.
+
+Dashboard page is served on / without authentication, it has no data itself
+and requests the API with token entered by user. The token is kept in
+browser localStorage, so it's readable by any script of the dashboard origin
+and stays in the browser until it's cleared. Serve the API over HTTPS, e.g.
+behind reverse proxy, and don't open the dashboard on shared machines.
+*/
+package api
+
+import (
+	"atlassian_backup/config"
+	"atlassian_backup/history"
+	"atlassian_backup/lib/utils"
+	"atlassian_backup/logger"
+	"atlassian_backup/processor"
+	"atlassian_backup/runstate"
+	"atlassian_backup/scheduler"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	basePath = "/api/v1/jobs"
+	// requestTimeout limits Atlassian API and storage calls of one request
+	requestTimeout = time.Minute
+	// defaultRunsLimit is the number of returned runs, if limit isn't set
+	defaultRunsLimit = 50
+)
+
+// A Server serves control API of scheduler jobs
+type Server struct {
+	config    *config.Config
+	scheduler *scheduler.Scheduler
+	dashboard http.Handler
+}
+
+// A job presents job in API responses
+type job struct {
+	Name      string        `json:"name"`
+	Workspace string        `json:"workspace"`
+	Type      string        `json:"type"`
+	Schedule  string        `json:"schedule,omitempty"`
+	Next      *time.Time    `json:"next,omitempty"`
+	Running   bool          `json:"running"`
+	LastRun   *runstate.Run `json:"lastRun,omitempty"`
+}
+
+// A progress presents live progress of job run
+type progress struct {
+	Job     string         `json:"job"`
+	Running bool           `json:"running"`
+	RunId   string         `json:"runId,omitempty"`
+	Phase   runstate.Phase `json:"phase,omitempty"`
+	Percent *int           `json:"percent,omitempty"`
+}
+
+// A savedBackup presents backup file in API responses
+type savedBackup struct {
+	Storage  string    `json:"storage"`
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+/*
+New returns new Server of scheduler jobs
+
+Arguments:
+
+	c *config.Config
+	s *scheduler.Scheduler
+
+Returns: *Server
+*/
+func New(c *config.Config, s *scheduler.Scheduler) *Server {
+	return &Server{config: c, scheduler: s, dashboard: dashboardHandler()}
+}
+
+/*
+Serve serves control API on addr until context is done. Returns error if
+server can't be started
+
+Arguments:
+
+	ctx context.Context
+	addr string: listen address, e.g. :8080
+
+Returns: error
+*/
+func (s *Server) Serve(ctx context.Context, addr string) (err error) {
+	defer func() { err = utils.WrapIfErr("can't serve control API", err) }()
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	err = server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+/*
+ServeHTTP authenticates API request and routes it to endpoint handler. Other
+requests are served by dashboard
+*/
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		s.route(w, r, http.MethodGet, s.dashboard.ServeHTTP)
+		return
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="atlassian_backup"`)
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.EscapedPath(), basePath)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	if parts[0] == "" {
+		s.route(w, r, http.MethodGet, s.listJobs)
+		return
+	}
+
+	name, err := url.PathUnescape(parts[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	j := s.job(name)
+	if j == nil {
+		writeError(w, http.StatusNotFound, scheduler.ErrUnknownJob)
+		return
+	}
+
+	if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	handlers := map[string]struct {
+		method string
+		handle func(w http.ResponseWriter, r *http.Request, j *config.Job)
+	}{
+		"":         {http.MethodGet, s.getJob},
+		"run":      {http.MethodPost, s.runJob},
+		"progress": {http.MethodGet, s.getProgress},
+		"backups":  {http.MethodGet, s.listBackups},
+		"runs":     {http.MethodGet, s.listRuns},
+	}
+
+	h, ok := handlers[action]
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	s.route(w, r, h.method, func(w http.ResponseWriter, r *http.Request) {
+		h.handle(w, r, j)
+	})
+}
+
+/*
+route calls handler, if request method is allowed
+
+Arguments:
+
+	w http.ResponseWriter
+	r *http.Request
+	method string: allowed method
+	handle http.HandlerFunc
+*/
+func (s *Server) route(
+	w http.ResponseWriter,
+	r *http.Request,
+	method string,
+	handle http.HandlerFunc,
+) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	handle(w, r)
+}
+
+// authorized reports whether request has valid bearer token
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || s.config.ApiToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.config.ApiToken)) == 1
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := make([]job, 0, len(s.config.Jobs))
+	for i := range s.config.Jobs {
+		jobs = append(jobs, s.jobInfo(&s.config.Jobs[i]))
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request, j *config.Job) {
+	writeJSON(w, http.StatusOK, s.jobInfo(j))
+}
+
+func (s *Server) runJob(w http.ResponseWriter, r *http.Request, j *config.Job) {
+	err := s.scheduler.Trigger(j.Name)
+	switch {
+	case errors.Is(err, scheduler.ErrRunning):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		logger.Infof("Job %s run is requested by control API\n", j.Name)
+		writeJSON(w, http.StatusAccepted, s.jobInfo(j))
+	}
+}
+
+/*
+getProgress returns phase of the job run and cloud backup progress, which
+is requested from Atlassian, while cloud backup is being created
+*/
+func (s *Server) getProgress(w http.ResponseWriter, r *http.Request, j *config.Job) {
+	p := progress{Job: j.Name, Running: s.scheduler.Running(j.Name)}
+
+	run, err := runstate.Load(s.config.DataDir, j.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if run != nil {
+		p.RunId, p.Phase = run.Id, run.Phase
+	}
+
+	if p.Running && run != nil && !run.DownloadOnly {
+		switch run.Phase {
+		case runstate.Started, runstate.Following:
+			ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+			defer cancel()
+
+			percent, err := processor.New(j, s.config.DataDir).Progress(ctx)
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			p.Percent = &percent
+		case runstate.Downloading:
+			percent := 100
+			p.Percent = &percent
+		}
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) listBackups(w http.ResponseWriter, r *http.Request, j *config.Job) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	saved, err := processor.New(j, s.config.DataDir).Backups(ctx)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	backups := make([]savedBackup, 0, len(saved))
+	for _, b := range saved {
+		backups = append(backups, savedBackup{
+			Storage:  b.Storage,
+			Name:     b.Name,
+			Size:     b.Size,
+			Modified: b.Modified,
+		})
+	}
+	writeJSON(w, http.StatusOK, backups)
+}
+
+// listRuns returns finished job runs from run history, the latest first
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request, j *config.Job) {
+	f := history.Filter{
+		Job:     j.Name,
+		Outcome: r.URL.Query().Get("outcome"),
+		Limit:   defaultRunsLimit,
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit %q is incorrect", limit))
+			return
+		}
+		f.Limit = n
+	}
+
+	runs, err := history.Read(s.config.DataDir, f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if runs == nil {
+		runs = []history.Record{}
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// job returns configured job by name or nil, if job is unknown
+func (s *Server) job(name string) *config.Job {
+	for i := range s.config.Jobs {
+		if s.config.Jobs[i].Name == name {
+			return &s.config.Jobs[i]
+		}
+	}
+	return nil
+}
+
+// jobInfo returns job with its schedule state and the last run state
+func (s *Server) jobInfo(j *config.Job) job {
+	info := job{
+		Name:      j.Name,
+		Workspace: j.AtlassianWorkspace,
+		Type:      j.BackupType,
+		Schedule:  j.Schedule,
+	}
+
+	for _, st := range s.scheduler.Jobs() {
+		if st.Name != j.Name {
+			continue
+		}
+		info.Running = st.Running
+		if !st.Next.IsZero() {
+			next := st.Next
+			info.Next = &next
+		}
+	}
+
+	run, err := runstate.Load(s.config.DataDir, j.Name)
+	if err != nil {
+		logger.Warningf("%v\n", err)
+	}
+	info.LastRun = run
+
+	return info
+}
+
+// writeJSON writes value as JSON response with status code
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warningf("Can't write API response: %v\n", err)
+	}
+}
+
+// writeError writes error response, error text is redacted
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": utils.Redact(err.Error())})
+}
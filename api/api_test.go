@@ -0,0 +1,300 @@
+package api
+
+import (
+	"atlassian_backup/config"
+	"atlassian_backup/history"
+	"atlassian_backup/scheduler"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const token = "api-test-token"
+
+/*
+newServer starts scheduler of two jobs with run function and control API
+server of it. Both are stopped, when test is finished
+*/
+func newServer(t *testing.T, run scheduler.Runner) (*httptest.Server, *config.Config) {
+	t.Helper()
+
+	c := &config.Config{
+		DataDir:  t.TempDir(),
+		ApiToken: token,
+		Jobs: []config.Job{
+			{
+				Name:               "example-jira",
+				AtlassianWorkspace: "example",
+				BackupType:         "jira",
+				Schedule:           "0 0 1 1 *",
+			},
+			{
+				Name:               "example confluence",
+				AtlassianWorkspace: "example",
+				BackupType:         "confluence",
+			},
+		},
+	}
+
+	s, err := scheduler.New(c, run)
+	if err != nil {
+		t.Fatalf("scheduler.New error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Scheduled job has next run time, when scheduler is started
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Jobs()[0].Next.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("scheduler isn't started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	srv := httptest.NewServer(New(c, s))
+	t.Cleanup(srv.Close)
+
+	return srv, c
+}
+
+// call sends API request with bearer token and returns response status and body
+func call(t *testing.T, srv *httptest.Server, method, path, bearer string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestAuthorization(t *testing.T) {
+	srv, _ := newServer(t, func(ctx context.Context, job *config.Job) error { return nil })
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong-token", http.StatusUnauthorized},
+		{"token prefix", "Bearer " + token[:5], http.StatusUnauthorized},
+		{"basic auth", "Basic " + token, http.StatusUnauthorized},
+		{"right token", "Bearer " + token, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/jobs", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := string(data)
+
+			if resp.StatusCode != tc.want {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tc.want, body)
+			}
+			if tc.want == http.StatusUnauthorized {
+				if resp.Header.Get("WWW-Authenticate") == "" {
+					t.Error("no WWW-Authenticate header")
+				}
+				if strings.Contains(body, "example-jira") {
+					t.Errorf("unauthorized response has jobs: %s", body)
+				}
+				return
+			}
+
+			var jobs []job
+			if err := json.Unmarshal([]byte(body), &jobs); err != nil {
+				t.Fatalf("response %s: %v", body, err)
+			}
+			if len(jobs) != 2 || jobs[0].Name != "example-jira" || jobs[0].Next == nil ||
+				jobs[1].Name != "example confluence" || jobs[1].Next != nil {
+				t.Errorf("jobs = %+v", jobs)
+			}
+		})
+	}
+}
+
+func TestDashboardIsPublic(t *testing.T) {
+	srv, _ := newServer(t, func(ctx context.Context, job *config.Job) error { return nil })
+
+	code, body := call(t, srv, http.MethodGet, "/", "")
+	if code != http.StatusOK || !strings.Contains(body, "<html") {
+		t.Errorf("dashboard = %d: %.100s", code, body)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	srv, _ := newServer(t, func(ctx context.Context, job *config.Job) error { return nil })
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/api/v1/jobs/example-jira", http.StatusOK},
+		{http.MethodGet, "/api/v1/jobs/example%20confluence", http.StatusOK},
+		{http.MethodGet, "/api/v1/jobs/unknown", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/jobs/unknown/run", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/jobs/example-jira/unknown", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/jobs/example-jira/runs/1", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/jobsx", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/jobs/example-jira/run", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/api/v1/jobs", http.StatusMethodNotAllowed},
+	} {
+		code, body := call(t, srv, tc.method, tc.path, token)
+		if code != tc.want {
+			t.Errorf("%s %s = %d, want %d: %s", tc.method, tc.path, code, tc.want, body)
+		}
+		if code >= 400 && !strings.Contains(body, `"error"`) {
+			t.Errorf("%s %s error response %s", tc.method, tc.path, body)
+		}
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	srv, _ := newServer(t, func(ctx context.Context, job *config.Job) error {
+		started <- job.Name
+		<-release
+		return nil
+	})
+	defer close(release)
+
+	code, body := call(t, srv, http.MethodPost, "/api/v1/jobs/example%20confluence/run", token)
+	if code != http.StatusAccepted {
+		t.Fatalf("run = %d, want 202: %s", code, body)
+	}
+	var j job
+	if err := json.Unmarshal([]byte(body), &j); err != nil || !j.Running {
+		t.Errorf("run response %s, want running job", body)
+	}
+
+	select {
+	case name := <-started:
+		if name != "example confluence" {
+			t.Errorf("started job %s", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job isn't started")
+	}
+
+	code, body = call(t, srv, http.MethodPost, "/api/v1/jobs/example%20confluence/run", token)
+	if code != http.StatusConflict {
+		t.Errorf("run of running job = %d, want 409: %s", code, body)
+	}
+}
+
+func TestListRuns(t *testing.T) {
+	srv, c := newServer(t, func(ctx context.Context, job *config.Job) error { return nil })
+
+	started := time.Now().Add(-time.Hour)
+	for i := 0; i < defaultRunsLimit+5; i++ {
+		outcome := history.Success
+		if i%2 == 1 {
+			outcome = history.Failure
+		}
+		err := history.Append(c.DataDir, &history.Record{
+			RunId:   fmt.Sprintf("run-%d", i),
+			Job:     "example-jira",
+			Started: started.Add(time.Duration(i) * time.Second),
+			Outcome: outcome,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := history.Append(c.DataDir, &history.Record{
+		RunId:   "other",
+		Job:     "example confluence",
+		Started: started,
+		Outcome: history.Success,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  int
+		first string
+	}{
+		{"", defaultRunsLimit, "run-54"},
+		{"?limit=3", 3, "run-54"},
+		{"?limit=0", defaultRunsLimit + 5, "run-54"},
+		{"?limit=1000", defaultRunsLimit + 5, "run-54"},
+		{"?limit=2&outcome=success", 2, "run-54"},
+		{"?limit=2&outcome=failure", 2, "run-53"},
+	} {
+		code, body := call(t, srv, http.MethodGet, "/api/v1/jobs/example-jira/runs"+tc.query, token)
+		if code != http.StatusOK {
+			t.Errorf("runs%s = %d: %s", tc.query, code, body)
+			continue
+		}
+
+		var runs []history.Record
+		if err := json.Unmarshal([]byte(body), &runs); err != nil {
+			t.Fatalf("runs%s response %s: %v", tc.query, body, err)
+		}
+		if len(runs) != tc.want || runs[0].RunId != tc.first {
+			t.Errorf("runs%s: %d runs from %s, want %d from %s",
+				tc.query, len(runs), runs[0].RunId, tc.want, tc.first)
+		}
+	}
+
+	for _, query := range []string{"?limit=-1", "?limit=ten", "?limit=1.5"} {
+		code, body := call(t, srv, http.MethodGet, "/api/v1/jobs/example-jira/runs"+query, token)
+		if code != http.StatusBadRequest || !strings.Contains(body, "limit") {
+			t.Errorf("runs%s = %d, want 400: %s", query, code, body)
+		}
+	}
+
+	// Job without runs has empty list, not null
+	code, body := call(t, srv, http.MethodGet, "/api/v1/jobs/example%20confluence/runs?outcome=failure", token)
+	if code != http.StatusOK || strings.TrimSpace(body) != "[]" {
+		t.Errorf("runs of job without failures = %d: %s", code, body)
+	}
+}
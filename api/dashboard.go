@@ -0,0 +1,25 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+/*
+dashboard is HTML page of backups state: runs history, sizes of saved
+backups over time, current progress and failures of every job. The page has
+no data itself, it requests control API with token entered by user. The
+page is served without authentication, token is kept in localStorage
+*/
+//go:embed dashboard
+var dashboard embed.FS
+
+// dashboardHandler serves dashboard files
+func dashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboard, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(files))
+}
@@ -0,0 +1,364 @@
+/*
+Package atlassiantest implements fake Atlassian Cloud site for integration
+testing: Jira backup endpoints (runbackup, lastTaskId, getProgress and
+download servlet) and Confluence OBM endpoints (runbackup, getprogress and
+download). Both products are served by one site, like the real one.
+
+Server behaviour is scripted by Scenario: slow progress, rejected run,
+failed or cancelled backup, throttling by 429 responses, slow and truncated
+downloads. The whole backup pipeline may be run offline by setting job
+Atlassian URL to server URL:
+
+	srv := atlassiantest.NewServer(atlassiantest.Scenario{
+		Progress: []int{0, 40, 80, 100},
+		Throttle: 2,
+	})
+	defer srv.Close()
+
+	os.Setenv("ATLASSIAN_URL", srv.URL)
+	os.Setenv("ATLASSIAN_ACCOUNT", atlassiantest.Account)
+	os.Setenv("ATLASSIAN_TOKEN", atlassiantest.Token)
+*/
+package atlassiantest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Credentials accepted by Server
+const (
+	Account = "backup@example.com"
+	Token   = "atlassian-test-token"
+)
+
+const (
+	jiraBackupPath         = "/rest/backup/1/export/runbackup"
+	jiraLastTaskIdPath     = "/rest/backup/1/export/lastTaskId"
+	jiraProgressPath       = "/rest/backup/1/export/getProgress"
+	jiraDownloadPath       = "/plugins/servlet/export/download/"
+	confluenceBackupPath   = "/wiki/rest/obm/1.0/runbackup"
+	confluenceProgressPath = "/wiki/rest/obm/1.0/getprogress"
+	confluenceDownloadPath = "/wiki/download/"
+
+	// fileId is ID of the only backup file of the site
+	fileId         = "0f2c8a4e-5b1d-4c3e-9a7f-1e2d3c4b5a69"
+	confluenceFile = "temp/filestore/" + fileId
+)
+
+// DefaultFile is backup file content, if Scenario doesn't set it
+var DefaultFile = []byte("PK\x05\x06" + string(make([]byte, 18)))
+
+/*
+A Scenario presents fake site behaviour.
+
+Progress is sequence of backup progress values returned by successive
+progress requests after backup run, the last value repeats. Empty Progress
+means, that backup is completed at once. File download is available, when
+progress reaches 100.
+
+Fail is backup state reported, when Progress is exhausted, e.g. "Failed" or
+"Cancelled", FailMessage is Atlassian error text. Empty Fail means success.
+
+Reject makes runbackup answer, that backup is already in progress.
+
+Throttle is number of the first API requests, which are answered 429 Too Many
+Requests with RetryAfter delay.
+
+Truncate is number of backup file bytes sent before download connection is
+broken, zero means whole file. Delay is delay before every response.
+*/
+type Scenario struct {
+	Progress    []int
+	Fail        string
+	FailMessage string
+	Reject      bool
+	Throttle    int
+	RetryAfter  time.Duration
+	File        []byte
+	Truncate    int
+	Delay       time.Duration
+}
+
+// A Server is fake Atlassian Cloud site
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	scenario Scenario
+	taskId   int
+	polls    int
+	calls    int
+	requests []string
+}
+
+/*
+NewServer starts and returns fake Atlassian site, which plays scenario. The
+caller should call Close, when finished
+
+Arguments:
+
+	s Scenario
+
+Returns: *Server
+*/
+func NewServer(s Scenario) *Server {
+	srv := &Server{scenario: s, taskId: 10000}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(jiraBackupPath, srv.api(srv.run))
+	mux.HandleFunc(jiraLastTaskIdPath, srv.api(srv.lastTaskId))
+	mux.HandleFunc(jiraProgressPath, srv.api(srv.jiraProgress))
+	mux.HandleFunc(jiraDownloadPath, srv.jiraDownload)
+	mux.HandleFunc(confluenceBackupPath, srv.api(srv.run))
+	mux.HandleFunc(confluenceProgressPath, srv.api(srv.confluenceProgress))
+	mux.HandleFunc(confluenceDownloadPath, srv.confluenceDownload)
+
+	srv.Server = httptest.NewServer(srv.handler(mux))
+	return srv
+}
+
+/*
+SetScenario replaces scenario and resets progress and throttling counters,
+e.g. to script the next backup run
+
+Arguments:
+
+	s Scenario
+*/
+func (srv *Server) SetScenario(s Scenario) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.scenario = s
+	srv.polls = 0
+	srv.calls = 0
+}
+
+/*
+Requests returns method and path of every request received by server, e.g.
+"POST /rest/backup/1/export/runbackup"
+
+Returns: []string
+*/
+func (srv *Server) Requests() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return append([]string(nil), srv.requests...)
+}
+
+// handler records requests, delays responses and checks authorization
+func (srv *Server) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		srv.requests = append(srv.requests, r.Method+" "+r.URL.Path)
+		delay := srv.scenario.Delay
+		srv.mu.Unlock()
+
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if acc, token, ok := r.BasicAuth(); !ok || acc != Account || token != Token {
+			http.Error(w, "Client must be authenticated to access this resource.", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// api wraps API endpoint handler with throttling
+func (srv *Server) api(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		srv.calls++
+		throttled := srv.calls <= srv.scenario.Throttle
+		retryAfter := srv.scenario.RetryAfter
+		srv.mu.Unlock()
+
+		if throttled {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// run starts new backup: new task ID is issued and progress is reset
+func (srv *Server) run(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.scenario.Reject {
+		http.Error(
+			w,
+			`{"error":"Backup is already in progress"}`,
+			http.StatusPreconditionFailed,
+		)
+		return
+	}
+
+	srv.taskId++
+	srv.polls = 0
+}
+
+// lastTaskId writes ID of the last backup task
+func (srv *Server) lastTaskId(w http.ResponseWriter, _ *http.Request) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	fmt.Fprint(w, srv.taskId)
+}
+
+// jiraProgress writes export task progress
+func (srv *Server) jiraProgress(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	if r.URL.Query().Get("taskId") != strconv.Itoa(srv.taskId) {
+		srv.mu.Unlock()
+		http.Error(w, `{"error":"Task not found"}`, http.StatusNotFound)
+		return
+	}
+	progress, failed := srv.poll()
+	s := srv.scenario
+	srv.mu.Unlock()
+
+	resp := map[string]any{"progress": progress}
+	switch {
+	case failed:
+		resp["status"] = s.Fail
+		resp["message"] = s.FailMessage
+	case progress >= 100:
+		resp["status"] = "Success"
+		resp["result"] = "export/download/?fileId=" + fileId
+	default:
+		resp["status"] = "InProgress"
+	}
+
+	writeJSON(w, resp)
+}
+
+// confluenceProgress writes backup progress
+func (srv *Server) confluenceProgress(w http.ResponseWriter, _ *http.Request) {
+	srv.mu.Lock()
+	progress, failed := srv.poll()
+	s := srv.scenario
+	srv.mu.Unlock()
+
+	resp := map[string]any{
+		"alternativePercentage": fmt.Sprintf("%d%%", progress),
+		"isOutdated":            false,
+	}
+	switch {
+	case failed:
+		resp["currentStatus"] = s.Fail
+		resp["errorMessage"] = s.FailMessage
+	case progress >= 100:
+		resp["currentStatus"] = "Backup complete"
+		resp["fileName"] = confluenceFile
+	default:
+		resp["currentStatus"] = "Backup in progress"
+	}
+
+	writeJSON(w, resp)
+}
+
+/*
+poll returns the next progress value of scenario and whether backup is
+failed. Must be called with locked mutex
+
+Returns:
+
+	progress int
+	failed bool
+*/
+func (srv *Server) poll() (progress int, failed bool) {
+	s := srv.scenario
+	step := srv.polls
+	srv.polls++
+
+	switch {
+	case step < len(s.Progress):
+		return s.Progress[step], false
+	case s.Fail != "":
+		if len(s.Progress) != 0 {
+			return s.Progress[len(s.Progress)-1], true
+		}
+		return 0, true
+	case len(s.Progress) != 0:
+		return s.Progress[len(s.Progress)-1], false
+	default:
+		return 100, false
+	}
+}
+
+// jiraDownload serves backup file by its ID
+func (srv *Server) jiraDownload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != jiraDownloadPath || r.URL.Query().Get("fileId") != fileId {
+		http.NotFound(w, r)
+		return
+	}
+	srv.download(w, r)
+}
+
+// confluenceDownload serves backup file by its name
+func (srv *Server) confluenceDownload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != confluenceDownloadPath+confluenceFile {
+		http.NotFound(w, r)
+		return
+	}
+	srv.download(w, r)
+}
+
+/*
+download writes backup file. If scenario truncates download, connection is
+broken after part of file is sent, so client gets unexpected EOF
+*/
+func (srv *Server) download(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	file := srv.scenario.File
+	truncate := srv.scenario.Truncate
+	srv.mu.Unlock()
+
+	if file == nil {
+		file = DefaultFile
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", strconv.Itoa(len(file)))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if truncate <= 0 || truncate >= len(file) {
+		w.Write(file)
+		return
+	}
+
+	w.Write(file[:truncate])
+	http.NewResponseController(w).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+// writeJSON writes value as JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -2,20 +2,103 @@
 package backup
 
 import (
-	"net/url"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 )
 
+/*
+A Tasker is implemented by backups, which have Atlassian task ID. TaskId
+returns ID of the followed task, SetTaskId makes Progress and File follow
+task with given ID, e.g. task of resumed run, instead of the last one
+
+Methods:
+
+	TaskId(ctx context.Context) (id string, err error)
+	SetTaskId(id string)
+*/
+type Tasker interface {
+	TaskId(ctx context.Context) (id string, err error)
+	SetTaskId(id string)
+}
+
+/*
+ErrInProgress is returned by Run, when Atlassian rejects new backup, because
+backup is already in progress or was run recently. The existing backup task
+can be followed by Progress and File as usual
+*/
+var ErrInProgress = errors.New("backup is already in progress or was run recently")
+
+/*
+ErrUnknownProgress is returned by Progress, when Atlassian response has no
+progress percentage, e.g. while backup is being prepared. Backup keeps
+running, so it's polled further
+*/
+var ErrUnknownProgress = errors.New("backup progress is unknown")
+
+/*
+A FailedError is returned by Progress and File, when Atlassian reports, that
+cloud backup is failed, cancelled or outdated. Message is Atlassian's own
+error text
+*/
+type FailedError struct {
+	State   string
+	Message string
+}
+
+func (e *FailedError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Atlassian reports backup is %s", e.State)
+	}
+	return fmt.Sprintf("Atlassian reports backup is %s: %s", e.State, e.Message)
+}
+
+// rejectMarkers are parts of Atlassian responses to rejected backup runs
+var rejectMarkers = [][]byte{
+	[]byte("already in progress"),
+	[]byte("frequency is limited"),
+	[]byte("backup.frequency.limit"),
+	[]byte("backup.limit.exceeded"),
+}
+
 /*
 A Backup presents backup object
 
 Methods:
 
-	Run() (err error)
-	Progress() (progress int, err error)
-	File() (u *url.URL, err error)
+	Run(ctx context.Context) (err error)
+	Progress(ctx context.Context) (progress int, err error)
+	File(ctx context.Context) (req *http.Request, err error)
+
+File returns backup file download request with authorization header, so
+credentials aren't put into URL. Progress and File return *FailedError, if
+Atlassian reports failed backup, so it isn't polled until timeout. Progress
+returns ErrUnknownProgress, if progress can't be got from Atlassian response
 */
 type Backup interface {
-	Run() (err error)
-	Progress() (progress int, err error)
-	File() (u *url.URL, err error)
+	Run(ctx context.Context) (err error)
+	Progress(ctx context.Context) (progress int, err error)
+	File(ctx context.Context) (req *http.Request, err error)
+}
+
+/*
+Rejected reports whether Atlassian response body means, that new backup isn't
+started because of running or recent backup
+
+Arguments:
+
+	body []byte
+
+Returns: bool
+*/
+func Rejected(body []byte) bool {
+	body = bytes.ToLower(body)
+	for _, m := range rejectMarkers {
+		if bytes.Contains(body, m) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,6 +1,14 @@
 // Package confluence implenments Confluence Cloud backup
 package confluence
 
+import (
+	"atlassian_backup/backup"
+	"atlassian_backup/lib/utils"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
 const (
 	backupBasePath   string = "/wiki/rest/obm/1.0/runbackup"
 	progressBasePath string = "/wiki/rest/obm/1.0/getprogress"
@@ -11,13 +19,86 @@ const (
 var backupReqData = []byte(`{"cbAttachments":"true","exportToCloud":"true"}`)
 
 type Backup struct {
-	Name               string
-	atlassianAccount   string
-	atlassianWorkspace string
-	atlassianToken     string
+	Name             string
+	atlassianAccount string
+	baseUrl          *url.URL
+	atlassianToken   string
+	retry            utils.RetryPolicy
 }
 
+/*
+A progressResponse presents Confluence backup progress. CurrentStatus is
+human-readable state or error text, IsOutdated means, that the backup file
+is older than the latest backup request
+*/
 type progressResponse struct {
-	Progress string `json:"alternativePercentage"`
-	Result   string `json:"fileName"`
+	Progress      string `json:"alternativePercentage"`
+	Result        string `json:"fileName"`
+	CurrentStatus string `json:"currentStatus"`
+	IsOutdated    bool   `json:"isOutdated"`
+	ErrorMessage  string `json:"errorMessage"`
+}
+
+/*
+terminalStatuses maps current status of failed or cancelled backup to its
+state. Status is matched exactly, because running backup reports transient
+problems in it too, e.g. "Retrying after error"
+*/
+var terminalStatuses = map[string]string{
+	"cancelled": "cancelled",
+	"canceled":  "cancelled",
+	"aborted":   "cancelled",
+	"failed":    "failed",
+	"error":     "failed",
+}
+
+/*
+failure returns *backup.FailedError, if Atlassian reports failed or
+cancelled backup, otherwise nil
+
+Returns: error
+*/
+func (r *progressResponse) failure() error {
+	if r.ErrorMessage != "" {
+		return &backup.FailedError{State: "failed", Message: r.ErrorMessage}
+	}
+
+	status := strings.ToLower(strings.TrimSpace(r.CurrentStatus))
+	if state, ok := terminalStatuses[status]; ok {
+		return &backup.FailedError{State: state, Message: r.CurrentStatus}
+	}
+
+	return nil
+}
+
+// header returns authorization header of Atlassian API requests
+func (b *Backup) header() http.Header {
+	return utils.BasicAuth(b.atlassianAccount, b.atlassianToken)
+}
+
+/*
+endpoint returns URL of Atlassian API path relative to site base URL
+
+Arguments:
+
+	path string
+	rawQuery string: encoded query
+
+Returns: *url.URL
+*/
+func (b *Backup) endpoint(path, rawQuery string) *url.URL {
+	u := *b.baseUrl
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = rawQuery
+	return &u
+}
+
+// download returns authorized backup file download request
+func (b *Backup) download(u *url.URL) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = b.header()
+	return req, nil
 }
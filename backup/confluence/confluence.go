@@ -2,67 +2,61 @@
 package confluence
 
 import (
+	"atlassian_backup/backup"
 	"atlassian_backup/lib/utils"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 )
 
-func New(acc, workspace, token string) *Backup {
+func New(acc string, base *url.URL, token string, retry utils.RetryPolicy) *Backup {
 	return &Backup{
-		Name:               "confluence_cloud_backup_" + utils.Timestamp() + ".zip",
-		atlassianAccount:   acc,
-		atlassianWorkspace: workspace,
-		atlassianToken:     token,
+		Name:             "confluence_cloud_backup_" + utils.Timestamp() + ".zip",
+		atlassianAccount: acc,
+		baseUrl:          base,
+		atlassianToken:   token,
+		retry:            retry,
 	}
 }
 
-func (b *Backup) Run() (err error) {
+func (b *Backup) Run(ctx context.Context) (err error) {
 	defer func() { err = utils.WrapIfErr("can't run backup", err) }()
 
-	URL := url.URL{
-		Scheme: "https",
-		User: url.UserPassword(
-			b.atlassianAccount,
-			b.atlassianToken,
-		),
-		Host: b.atlassianWorkspace + ".atlassian.net",
-		Path: backupBasePath,
-	}
+	URL := b.endpoint(backupBasePath, "")
 
 	reqData := bytes.NewReader(backupReqData)
 
-	data, err := utils.Request(http.MethodPost, &URL, reqData)
+	data, err := utils.Request(ctx, b.retry, http.MethodPost, URL, b.header(), reqData)
+	var se *utils.StatusError
+	if errors.As(err, &se) && backup.Rejected(se.Body) {
+		return backup.ErrInProgress
+	}
 	if err != nil {
 		return err
 	}
 
 	if len(data) != 0 {
+		if backup.Rejected(data) {
+			return backup.ErrInProgress
+		}
 		return errors.New(string(data))
 	}
 
 	return nil
 }
 
-func (b *Backup) Progress() (progress int, err error) {
+func (b *Backup) Progress(ctx context.Context) (progress int, err error) {
 	defer func() { err = utils.WrapIfErr("can't get backup progress", err) }()
 
-	URL := url.URL{
-		Scheme: "https",
-		User: url.UserPassword(
-			b.atlassianAccount,
-			b.atlassianToken,
-		),
-		Host: b.atlassianWorkspace + ".atlassian.net",
-		Path: progressBasePath,
-	}
+	URL := b.endpoint(progressBasePath, "")
 
-	data, err := utils.Request(http.MethodGet, &URL, nil)
+	data, err := utils.Request(ctx, b.retry, http.MethodGet, URL, b.header(), nil)
 	if err != nil {
 		return 0, err
 	}
@@ -71,24 +65,19 @@ func (b *Backup) Progress() (progress int, err error) {
 	if err := json.Unmarshal(data, &resp); err != nil {
 		return 0, err
 	}
+	if err := resp.failure(); err != nil {
+		return 0, err
+	}
 
-	return convertSize(resp.Progress), nil
+	return convertSize(resp.Progress)
 }
 
-func (b *Backup) File() (u *url.URL, err error) {
+func (b *Backup) File(ctx context.Context) (req *http.Request, err error) {
 	defer func() { err = utils.WrapIfErr("can't get backup file URL", err) }()
 
-	URL := url.URL{
-		Scheme: "https",
-		User: url.UserPassword(
-			b.atlassianAccount,
-			b.atlassianToken,
-		),
-		Host: b.atlassianWorkspace + ".atlassian.net",
-		Path: progressBasePath,
-	}
+	URL := b.endpoint(progressBasePath, "")
 
-	data, err := utils.Request(http.MethodGet, &URL, nil)
+	data, err := utils.Request(ctx, b.retry, http.MethodGet, URL, b.header(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -97,25 +86,43 @@ func (b *Backup) File() (u *url.URL, err error) {
 	if err := json.Unmarshal(data, &resp); err != nil {
 		return nil, err
 	}
+	if err := resp.failure(); err != nil {
+		return nil, err
+	}
+	if resp.IsOutdated {
+		return nil, &backup.FailedError{
+			State:   "outdated",
+			Message: "the latest backup file is older than the latest backup request",
+		}
+	}
+	if resp.Result == "" {
+		return nil, errors.New("no backup file in Atlassian response")
+	}
 
-	return &url.URL{
-		Scheme: "https",
-		User: url.UserPassword(
-			b.atlassianAccount,
-			b.atlassianToken,
-		),
-		Host: b.atlassianWorkspace + ".atlassian.net",
-		Path: downloadBasePath + resp.Result,
-	}, nil
+	return b.download(b.endpoint(downloadBasePath+resp.Result, ""))
 }
 
-func convertSize(sizeStr string) int {
+/*
+convertSize parses progress percentage, e.g. "40%". Returns
+backup.ErrUnknownProgress, if there is no percentage, e.g. while Atlassian
+prepares backup
+
+Arguments:
+
+	sizeStr string
+
+Returns:
+
+	int
+	error
+*/
+func convertSize(sizeStr string) (int, error) {
 	re := regexp.MustCompile(percentageRegex)
 
 	p, err := strconv.Atoi(re.FindString(sizeStr))
 	if err != nil {
-		log.Fatal(err)
+		return 0, fmt.Errorf("%w: unexpected progress %q", backup.ErrUnknownProgress, sizeStr)
 	}
 
-	return p
+	return p, nil
 }
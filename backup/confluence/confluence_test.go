@@ -0,0 +1,114 @@
+package confluence
+
+import (
+	"atlassian_backup/backup"
+	"atlassian_backup/lib/utils"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestConvertSize(t *testing.T) {
+	for _, tc := range []struct {
+		size string
+		want int
+	}{
+		{"0%", 0},
+		{"40%", 40},
+		{"100%", 100},
+		{"Progress: 7 %", 7},
+	} {
+		if got, err := convertSize(tc.size); err != nil || got != tc.want {
+			t.Errorf("convertSize(%q) = %d, %v, want %d", tc.size, got, err, tc.want)
+		}
+	}
+
+	for _, size := range []string{"", "%", "Preparing"} {
+		if _, err := convertSize(size); !errors.Is(err, backup.ErrUnknownProgress) {
+			t.Errorf("convertSize(%q) error = %v, want ErrUnknownProgress", size, err)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		response string
+		want     int
+		check    func(err error) bool
+	}{
+		{
+			name:     "percentage",
+			response: `{"alternativePercentage":"40%","currentStatus":"Backup in progress"}`,
+			want:     40,
+			check:    func(err error) bool { return err == nil },
+		},
+		{
+			name:     "no percentage",
+			response: `{"currentStatus":"Preparing backup"}`,
+			check: func(err error) bool {
+				return errors.Is(err, backup.ErrUnknownProgress)
+			},
+		},
+		{
+			name:     "failed",
+			response: `{"alternativePercentage":"","errorMessage":"Not enough space"}`,
+			check: func(err error) bool {
+				var fe *backup.FailedError
+				return errors.As(err, &fe) && fe.Message == "Not enough space"
+			},
+		},
+		{
+			name:     "cancelled",
+			response: `{"alternativePercentage":"","currentStatus":"Cancelled"}`,
+			check: func(err error) bool {
+				var fe *backup.FailedError
+				return errors.As(err, &fe) && fe.State == "cancelled"
+			},
+		},
+		{
+			// Transient problem of running backup isn't its failure
+			name:     "retrying after error",
+			response: `{"alternativePercentage":"60%","currentStatus":"Retrying after error"}`,
+			want:     60,
+			check:    func(err error) bool { return err == nil },
+		},
+		{
+			name:     "failed attachment",
+			response: `{"currentStatus":"Skipping failed attachment"}`,
+			check: func(err error) bool {
+				return errors.Is(err, backup.ErrUnknownProgress)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != progressBasePath {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			defer srv.Close()
+
+			base, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := New("backup@example.com", base, "token", utils.RetryPolicy{
+				MaxAttempts:  1,
+				InitialDelay: time.Millisecond,
+				MaxDelay:     time.Millisecond,
+			})
+
+			got, err := b.Progress(context.Background())
+			if !tc.check(err) || got != tc.want {
+				t.Errorf("Progress = %d, %v, want %d", got, err, tc.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,14 @@
 // Package jira implements Jira Cloud backup
 package jira
 
+import (
+	"atlassian_backup/backup"
+	"atlassian_backup/lib/utils"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
 const (
 	backupBasePath     string = "/rest/backup/1/export/runbackup"
 	lastTaskIdBasePath string = "/rest/backup/1/export/lastTaskId"
@@ -12,13 +20,89 @@ const (
 var backupReqData = []byte(`{"cbAttachments":"true","exportToCloud":"true"}`)
 
 type Backup struct {
-	Name               string
-	atlassianAccount   string
-	atlassianWorkspace string
-	atlassianToken     string
+	Name             string
+	atlassianAccount string
+	baseUrl          *url.URL
+	atlassianToken   string
+	retry            utils.RetryPolicy
+	// taskId is ID of the followed export task, the last task of the site
+	// is followed, if it's empty
+	taskId string
 }
 
+/*
+A progressResponse presents Jira export task progress. Status is task state,
+e.g. Enqueued, Running, Success, Failed or Cancelled. Message, description
+and result have error text of failed task
+*/
 type progressResponse struct {
-	Progress int    `json:"progress"`
-	Result   string `json:"result"`
+	Status      string `json:"status"`
+	Description string `json:"description"`
+	Message     string `json:"message"`
+	Progress    int    `json:"progress"`
+	Result      string `json:"result"`
+}
+
+// failedStates are export task states, which won't become successful
+var failedStates = map[string]string{
+	"failed":           "failed",
+	"dead":             "failed",
+	"cancelled":        "cancelled",
+	"canceled":         "cancelled",
+	"cancel_requested": "cancelled",
+	"cancelrequested":  "cancelled",
+}
+
+/*
+failure returns *backup.FailedError, if Atlassian reports failed or
+cancelled export task, otherwise nil
+
+Returns: error
+*/
+func (r *progressResponse) failure() error {
+	state, ok := failedStates[strings.ToLower(r.Status)]
+	if !ok {
+		return nil
+	}
+
+	var texts []string
+	for _, t := range []string{r.Message, r.Description, r.Result} {
+		if t != "" {
+			texts = append(texts, t)
+		}
+	}
+
+	return &backup.FailedError{State: state, Message: strings.Join(texts, "; ")}
+}
+
+// header returns authorization header of Atlassian API requests
+func (b *Backup) header() http.Header {
+	return utils.BasicAuth(b.atlassianAccount, b.atlassianToken)
+}
+
+/*
+endpoint returns URL of Atlassian API path relative to site base URL
+
+Arguments:
+
+	path string
+	rawQuery string: encoded query
+
+Returns: *url.URL
+*/
+func (b *Backup) endpoint(path, rawQuery string) *url.URL {
+	u := *b.baseUrl
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = rawQuery
+	return &u
+}
+
+// download returns authorized backup file download request
+func (b *Backup) download(u *url.URL) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = b.header()
+	return req, nil
 }
@@ -2,55 +2,58 @@
 package jira
 
 import (
+	"atlassian_backup/backup"
 	"atlassian_backup/lib/utils"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
 )
 
-func New(acc, workspace, token string) *Backup {
+func New(acc string, base *url.URL, token string, retry utils.RetryPolicy) *Backup {
 	return &Backup{
-		Name:               "jira_cloud_backup_" + utils.Timestamp() + ".zip",
-		atlassianAccount:   acc,
-		atlassianWorkspace: workspace,
-		atlassianToken:     token,
+		Name:             "jira_cloud_backup_" + utils.Timestamp() + ".zip",
+		atlassianAccount: acc,
+		baseUrl:          base,
+		atlassianToken:   token,
+		retry:            retry,
 	}
 }
 
-func (b *Backup) Run() (err error) {
+func (b *Backup) Run(ctx context.Context) (err error) {
 	defer func() { err = utils.WrapIfErr("can't run backup", err) }()
 
-	URL := url.URL{
-		Scheme: "https",
-		User: url.UserPassword(
-			b.atlassianAccount,
-			b.atlassianToken,
-		),
-		Host: b.atlassianWorkspace + ".atlassian.net",
-		Path: backupBasePath,
-	}
+	URL := b.endpoint(backupBasePath, "")
 
 	reqData := bytes.NewReader(backupReqData)
 
-	data, err := utils.Request(http.MethodPost, &URL, reqData)
+	data, err := utils.Request(ctx, b.retry, http.MethodPost, URL, b.header(), reqData)
+	var se *utils.StatusError
+	if errors.As(err, &se) && backup.Rejected(se.Body) {
+		return backup.ErrInProgress
+	}
 	if err != nil {
 		return err
 	}
 
 	if len(data) != 0 {
+		if backup.Rejected(data) {
+			return backup.ErrInProgress
+		}
 		return errors.New(string(data))
 	}
 
 	return nil
 }
 
-func (b *Backup) Progress() (progress int, err error) {
+func (b *Backup) Progress(ctx context.Context) (progress int, err error) {
 	defer func() { err = utils.WrapIfErr("can't get backup progress", err) }()
 
-	taskId, err := b.lastTaskId()
+	taskId, err := b.TaskId(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -58,18 +61,9 @@ func (b *Backup) Progress() (progress int, err error) {
 	query := url.Values{}
 	query.Add("taskId", taskId)
 
-	URL := url.URL{
-		Scheme: "https",
-		User: url.UserPassword(
-			b.atlassianAccount,
-			b.atlassianToken,
-		),
-		Host:     b.atlassianWorkspace + ".atlassian.net",
-		Path:     progressBasePath,
-		RawQuery: query.Encode(),
-	}
+	URL := b.endpoint(progressBasePath, query.Encode())
 
-	data, err := utils.Request(http.MethodGet, &URL, nil)
+	data, err := utils.Request(ctx, b.retry, http.MethodGet, URL, b.header(), nil)
 	if err != nil {
 		return 0, err
 	}
@@ -78,14 +72,17 @@ func (b *Backup) Progress() (progress int, err error) {
 	if err := json.Unmarshal(data, &resp); err != nil {
 		return 0, err
 	}
+	if err := resp.failure(); err != nil {
+		return 0, err
+	}
 
 	return resp.Progress, nil
 }
 
-func (b *Backup) File() (u *url.URL, err error) {
+func (b *Backup) File(ctx context.Context) (req *http.Request, err error) {
 	defer func() { err = utils.WrapIfErr("can't get backup file URL", err) }()
 
-	taskId, err := b.lastTaskId()
+	taskId, err := b.TaskId(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -93,18 +90,9 @@ func (b *Backup) File() (u *url.URL, err error) {
 	progQuery := url.Values{}
 	progQuery.Add("taskId", taskId)
 
-	URL := url.URL{
-		Scheme: "https",
-		User: url.UserPassword(
-			b.atlassianAccount,
-			b.atlassianToken,
-		),
-		Host:     b.atlassianWorkspace + ".atlassian.net",
-		Path:     progressBasePath,
-		RawQuery: progQuery.Encode(),
-	}
+	URL := b.endpoint(progressBasePath, progQuery.Encode())
 
-	data, err := utils.Request(http.MethodGet, &URL, nil)
+	data, err := utils.Request(ctx, b.retry, http.MethodGet, URL, b.header(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -112,34 +100,59 @@ func (b *Backup) File() (u *url.URL, err error) {
 	if err := json.Unmarshal(data, &resp); err != nil {
 		return nil, err
 	}
+	if err := resp.failure(); err != nil {
+		return nil, err
+	}
+
+	fileId := b.fileId(resp.Result)
+	if fileId == "" {
+		return nil, fmt.Errorf("no backup file in Atlassian response %q", resp.Result)
+	}
 
 	resQuery := url.Values{}
-	resQuery.Add("fileId", b.fileId(resp.Result))
+	resQuery.Add("fileId", fileId)
+
+	return b.download(b.endpoint(downloadBasePath, resQuery.Encode()))
+}
+
+/*
+TaskId returns ID of the followed export task. If task isn't set, the last
+task of the site is followed since the first call, so backup, started later
+by another client, doesn't replace it
+
+Arguments:
 
-	u = &url.URL{
-		Scheme: "https",
-		User: url.UserPassword(
-			b.atlassianAccount,
-			b.atlassianToken,
-		),
-		Host:     b.atlassianWorkspace + ".atlassian.net",
-		Path:     downloadBasePath,
-		RawQuery: resQuery.Encode(),
+	ctx context.Context
+
+Returns:
+
+	string
+	error
+*/
+func (b *Backup) TaskId(ctx context.Context) (string, error) {
+	if b.taskId != "" {
+		return b.taskId, nil
 	}
 
-	return u, nil
+	id, err := b.lastTaskId(ctx)
+	if err != nil {
+		return "", err
+	}
+	b.taskId = id
+
+	return id, nil
 }
 
-func (b *Backup) lastTaskId() (string, error) {
+// SetTaskId makes Progress and File follow export task with ID
+func (b *Backup) SetTaskId(id string) {
+	b.taskId = id
+}
 
-	URL := url.URL{
-		Scheme: "https",
-		User:   url.UserPassword(b.atlassianAccount, b.atlassianToken),
-		Host:   b.atlassianWorkspace + ".atlassian.net",
-		Path:   lastTaskIdBasePath,
-	}
+func (b *Backup) lastTaskId(ctx context.Context) (string, error) {
+
+	URL := b.endpoint(lastTaskIdBasePath, "")
 
-	data, err := utils.Request(http.MethodGet, &URL, nil)
+	data, err := utils.Request(ctx, b.retry, http.MethodGet, URL, b.header(), nil)
 	if err != nil {
 		return "", utils.Wrap("can't get last task ID", err)
 	}
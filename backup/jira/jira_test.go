@@ -0,0 +1,116 @@
+package jira
+
+import (
+	"atlassian_backup/lib/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const fileId = "0f2c8a4e-5b1d-4c3e-9a7f-1e2d3c4b5a69"
+
+/*
+fakeSite is Jira site, which last task is changed by another client, e.g.
+manual export. It records task IDs of progress requests
+*/
+type fakeSite struct {
+	mu         sync.Mutex
+	lastTask   string
+	lastCalls  int
+	progressOf []string
+}
+
+func (f *fakeSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case lastTaskIdBasePath:
+		f.lastCalls++
+		fmt.Fprint(w, f.lastTask)
+	case progressBasePath:
+		f.progressOf = append(f.progressOf, r.URL.Query().Get("taskId"))
+		fmt.Fprintf(
+			w,
+			`{"status":"Success","progress":100,"result":"export/download/?fileId=%s"}`,
+			fileId,
+		)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newBackup(t *testing.T, f *fakeSite) *Backup {
+	t.Helper()
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New("backup@example.com", base, "token", utils.RetryPolicy{
+		MaxAttempts:  1,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     time.Millisecond,
+	})
+}
+
+func TestSetTaskIdIsFollowed(t *testing.T) {
+	f := &fakeSite{lastTask: "10002"}
+	b := newBackup(t, f)
+
+	// Run is resumed after another export was started
+	b.SetTaskId("10001")
+
+	if _, err := b.Progress(context.Background()); err != nil {
+		t.Fatalf("Progress error: %v", err)
+	}
+	req, err := b.File(context.Background())
+	if err != nil {
+		t.Fatalf("File error: %v", err)
+	}
+	if id, err := b.TaskId(context.Background()); err != nil || id != "10001" {
+		t.Errorf("TaskId = %q, %v, want 10001", id, err)
+	}
+
+	if f.lastCalls != 0 {
+		t.Errorf("last task ID is requested %d times", f.lastCalls)
+	}
+	if len(f.progressOf) != 2 || f.progressOf[0] != "10001" || f.progressOf[1] != "10001" {
+		t.Errorf("progress of tasks %q, want 10001", f.progressOf)
+	}
+	if req.URL.Query().Get("fileId") != fileId {
+		t.Errorf("download URL %s", req.URL)
+	}
+}
+
+func TestLastTaskIsKept(t *testing.T) {
+	f := &fakeSite{lastTask: "10001"}
+	b := newBackup(t, f)
+
+	if id, err := b.TaskId(context.Background()); err != nil || id != "10001" {
+		t.Fatalf("TaskId = %q, %v, want 10001", id, err)
+	}
+
+	// Newer task of another client doesn't replace followed one
+	f.mu.Lock()
+	f.lastTask = "10002"
+	f.mu.Unlock()
+
+	if _, err := b.Progress(context.Background()); err != nil {
+		t.Fatalf("Progress error: %v", err)
+	}
+	if f.lastCalls != 1 {
+		t.Errorf("last task ID is requested %d times, want 1", f.lastCalls)
+	}
+	if len(f.progressOf) != 1 || f.progressOf[0] != "10001" {
+		t.Errorf("progress of tasks %q, want 10001", f.progressOf)
+	}
+}
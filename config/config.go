@@ -2,34 +2,173 @@
 package config
 
 import (
+	"atlassian_backup/logger"
 	"flag"
-	"log"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	// defaultMaxAge is the backup age, after which check reports backup overdue
+	defaultMaxAge = 50 * time.Hour
+	// defaultDataDir is the folder for application state files
+	defaultDataDir = ".atlassian_backup"
+	// defaultLockTtl is the run lock lifetime without refresh
+	defaultLockTtl = 10 * time.Minute
+	// Backup progress polling defaults
+	defaultPollInitialInterval = 10 * time.Second
+	defaultPollMaxInterval     = 5 * time.Minute
+	defaultPollStallTimeout    = time.Hour
+	// Pipeline phases timeouts defaults, run isn't limited by default
+	defaultGenerationTimeout = 24 * time.Hour
+	defaultDownloadTimeout   = 4 * time.Hour
+	defaultUploadTimeout     = 30 * time.Minute
+)
+
+/*
+A Config presents application configuration: list of backup jobs, folder
+for application state files, number of concurrently run jobs, metrics
+export and control API settings. Zero Concurrency means one job at a time for
+run and download commands and no limit in daemon mode
+*/
 type Config struct {
+	Jobs           []Job
+	DataDir        string
+	Concurrency    int
+	MetricsAddr    string
+	PushgatewayUrl string
+	ApiAddr        string
+	ApiToken       string
+
+	problems    []Problem
+	settingName func(setting string) string
+}
+
+// A Job presents backup of one Atlassian product in one workspace
+type Job struct {
+	Name               string
 	AtlassianAccount   string
 	AtlassianWorkspace string
+	AtlassianUrl       string
 	AtlassianToken     string
 	BackupType         string
-	StorageType        string
-	NotifyType         string
+	Storages           []Storage
+	Retention          Retention
+	Notifiers          []Notifier
+	HeartbeatUrl       string
+	MaxAge             time.Duration
+	Schedule           string
+	Retry              Retry
+	Poll               Poll
+	Timeouts           Timeouts
+	LockTtl            time.Duration
+}
+
+/*
+A Storage presents backup files storage. Backup files are saved under
+<Prefix>/<workspace>/<Type>/Cloud/ in GS bucket or local folder, e.g.
+backups/example/Jira/Cloud/. Credentials is service account JSON key for GS,
+application default credentials are used if it's empty
+*/
+type Storage struct {
+	Type        string
+	Prefix      string
+	Bucket      string
+	Folder      string
+	Credentials string
+}
+
+/*
+A Retention presents saved backups removal policy. Zero values mean keep
+all backups
+*/
+type Retention struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+/*
+A Retry presents retry policy of Atlassian API requests and backup progress
+polling: max attempts and exponential backoff delays
+*/
+type Retry struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+/*
+A Poll presents backup progress polling: interval is InitialInterval while
+progress moves and grows up to MaxInterval while it stands still. Stall is
+notified, if progress doesn't move for StallTimeout
+*/
+type Poll struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	StallTimeout    time.Duration
+}
+
+/*
+A Timeouts presents limits of backup run and its phases: Generation is cloud
+backup run and progress polling, Download is streaming of backup file to
+storage target, Upload is commit of saved file in storage target. Zero Run
+means no limit of the whole run
+*/
+type Timeouts struct {
+	Run        time.Duration
+	Generation time.Duration
+	Download   time.Duration
+	Upload     time.Duration
+}
+
+// A Notifier presents notification channel with minimal message severity
+type Notifier struct {
+	Type        string
+	MinSeverity string
+	WebhookUrl  string
+	RoutingKey  string
+	EventsUrl   string
+	ApiKey      string
+	ApiUrl      string
+	Priority    string
 }
 
 /*
 Supported types
 */
 var (
-	backupTypes  [2]string = [2]string{"jira", "confluence"}
-	storageTypes [2]string = [2]string{"gs", "local"}
-	notifyTypes  [1]string = [1]string{"slack"}
+	backupTypes [2]string = [2]string{"jira", "confluence"}
+	severities  [3]string = [3]string{"info", "warning", "error"}
 )
 
 /*
-MustLoad get application configuration from command-line arguments
-or environment. Close programm with fatal message, if no arguments are set
-or their values are incorrect. Some storage and notification types has specific
-configurations.
+MustLoad get application configuration by Load. Close programm with fatal
+message, which lists all incorrect settings, if configuration is invalid.
+
+Returns: Config
+*/
+func MustLoad() *Config {
+	c, err := Load()
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	return c
+}
+
+/*
+Load get application configuration from configuration file, command-line
+arguments or environment. Returns *ValidationError, which lists every
+missing or incorrect setting, if configuration is invalid.
+
+If configuration file is set by -config flag or CONFIG_FILE environment
+variable, all jobs are loaded from it (see LoadFile). DATA_DIR,
+CONCURRENCY, METRICS_ADDR, PUSHGATEWAY_URL, API_ADDR and their flags
+override file settings, API_TOKEN is used, if file has no apiToken.
+Otherwise single job is configured by flags and environment. Some storage
+and notification types has specific configurations.
 
 Environment variables:
 
@@ -40,18 +179,99 @@ Environment variables:
 	STORAGE_TYPE
 	NOTIFY_TYPE
 
+NOTIFY_TYPE is a comma-separated list of notifiers. Every notifier may have
+a minimal severity of messages after colon, e.g. "slack,pagerduty:error"
+sends everything to Slack and only failures to PagerDuty. Supported
+severities: info (default), warning, error. PagerDuty and Opsgenie open an
+alert on failure and resolve it on the next successful backup.
+
+Optional environment variables:
+
+	ATLASSIAN_URL: Atlassian site base URL, e.g. URL of fake server in
+	integration tests (default https://<workspace>.atlassian.net)
+	HEARTBEAT_URL: healthchecks.io-style ping URL
+	BACKUP_MAX_AGE: age of the latest backup, after which check command
+	reports it overdue, e.g. 72h (default 50h)
+	SCHEDULE: cron expression of backup runs in daemon mode, e.g. "0 2 * * *"
+	DATA_DIR: folder for application state files (default .atlassian_backup)
+	CONCURRENCY: number of jobs run at the same time (default 1 for run and
+	download commands, no limit in daemon mode)
+	RETRY_MAX_ATTEMPTS: Atlassian API request attempts (default 5)
+	RETRY_INITIAL_DELAY: delay before the first retry (default 2s)
+	RETRY_MAX_DELAY: max delay between retries (default 1m)
+	POLL_INITIAL_INTERVAL: backup progress polling interval (default 10s)
+	POLL_MAX_INTERVAL: max polling interval, while progress stands still
+	(default 5m)
+	POLL_STALL_TIMEOUT: progress stall time, after which stall is notified
+	(default 1h)
+	RUN_TIMEOUT: limit of the whole run (default no limit)
+	GENERATION_TIMEOUT: limit of cloud backup creation (default 24h)
+	DOWNLOAD_TIMEOUT: limit of backup file download to storage (default 4h)
+	UPLOAD_TIMEOUT: limit of saved file commit in storage (default 30m)
+	LOCK_TTL: run lock lifetime, after which lock of crashed run is stale
+	(default 10m)
+	METRICS_ADDR: listen address of Prometheus /metrics endpoint in daemon
+	mode, e.g. :9090
+	PUSHGATEWAY_URL: Prometheus Pushgateway URL, metrics of run and download
+	commands are pushed to it
+	API_ADDR: listen address of HTTP control API and dashboard in daemon
+	mode, e.g. :8080
+	API_TOKEN: bearer token of control API requests, dashboard is served
+	without it and keeps token entered by user in browser localStorage
+	LOG_FORMAT: text, logfmt or json (default text)
+	LOG_LEVEL: debug, info, warning or error (default info)
+	OTEL_EXPORTER_OTLP_ENDPOINT: OTLP HTTP endpoint, traces of backup runs
+	are exported to it (see tracing package)
+
+Storage environment variables:
+
+	GS_BUCKET_NAME: Google Storage bucket name (gs)
+	GS_CREDENTIALS: service account JSON key, optional (gs)
+	LOCAL_FOLDER: backups folder (local)
+
+Notification environment variables:
+
+	SLACK_WEBHOOK_URL (slack)
+	PAGERDUTY_ROUTING_KEY, PAGERDUTY_EVENTS_URL (pagerduty)
+	OPSGENIE_API_KEY, OPSGENIE_API_URL, OPSGENIE_PRIORITY (opsgenie)
+
 Command-line flags:
 
+	-config
 	-atlassianAccount
 	-atlassianWorkspace
+	-atlassianUrl
 	-atlassianToken
 	-backupType
 	-storageType
 	-notifyType
+	-heartbeatUrl
+	-maxAge
+	-schedule
+	-dataDir
+	-concurrency
+	-lockTtl
+	-metricsAddr
+	-pushgatewayUrl
+	-apiAddr
 
-Returns: Config
+Atlassian token, API token, heartbeat URL, storage credentials and notifiers webhook
+URLs and keys may be secret references instead of values, e.g.
+file:///run/secrets/atlassian_token or vault://secret/data/atlassian#token,
+so secrets don't leak into process list (see package lib/secret).
+
+Returns:
+
+	*Config
+	error
 */
-func MustLoad() *Config {
+func Load() (*Config, error) {
+	configFile := flag.String(
+		"config",
+		"",
+		"Path to YAML configuration file with backup jobs",
+	)
+
 	atlassianAccount := flag.String(
 		"atlassianAccount",
 		"",
@@ -64,6 +284,12 @@ func MustLoad() *Config {
 		"Atlassian workspace name",
 	)
 
+	atlassianUrl := flag.String(
+		"atlassianUrl",
+		"",
+		"Atlassian site base URL (default https://<workspace>.atlassian.net)",
+	)
+
 	atlassianToken := flag.String(
 		"atlassianToken",
 		"",
@@ -85,78 +311,341 @@ func MustLoad() *Config {
 	notifyType := flag.String(
 		"notifyType",
 		"",
-		"How you want to get notification",
+		"How you want to get notification (e.g. slack or slack:error)",
+	)
+
+	heartbeatUrl := flag.String(
+		"heartbeatUrl",
+		"",
+		"Ping URL of healthchecks.io-style monitoring",
+	)
+
+	maxAge := flag.Duration(
+		"maxAge",
+		0,
+		"Age of the latest backup, after which it's overdue (default 50h)",
+	)
+
+	schedule := flag.String(
+		"schedule",
+		"",
+		"Cron expression of backup runs in daemon mode",
+	)
+
+	lockTtl := flag.Duration(
+		"lockTtl",
+		0,
+		"Run lock lifetime, after which lock of crashed run is stale (default 10m)",
+	)
+
+	dataDir := flag.String(
+		"dataDir",
+		"",
+		"Folder for application state files",
+	)
+
+	concurrency := flag.Int(
+		"concurrency",
+		0,
+		"Number of jobs run at the same time",
+	)
+
+	metricsAddr := flag.String(
+		"metricsAddr",
+		"",
+		"Listen address of Prometheus /metrics endpoint in daemon mode",
+	)
+
+	pushgatewayUrl := flag.String(
+		"pushgatewayUrl",
+		"",
+		"Prometheus Pushgateway URL for one-shot runs metrics",
+	)
+
+	apiAddr := flag.String(
+		"apiAddr",
+		"",
+		"Listen address of HTTP control API in daemon mode",
 	)
 
 	flag.Parse()
 
-	if *atlassianAccount == "" {
-		acc, ok := os.LookupEnv("ATLASSIAN_ACCOUNT")
-		if !ok {
-			log.Fatal("Atlassian account is not specified")
+	if *dataDir == "" {
+		*dataDir = os.Getenv("DATA_DIR")
+	}
+
+	if *metricsAddr == "" {
+		*metricsAddr = os.Getenv("METRICS_ADDR")
+	}
+
+	if *concurrency == 0 {
+		var env Config
+		*concurrency = env.envInt("CONCURRENCY")
+		if len(env.problems) != 0 {
+			return nil, &ValidationError{Problems: env.problems}
 		}
-		*atlassianAccount = acc
+	}
+	if *concurrency < 0 {
+		return nil, &ValidationError{Problems: []Problem{{
+			Setting: "CONCURRENCY or -concurrency",
+			Message: "Concurrency must not be negative",
+		}}}
+	}
+
+	if *pushgatewayUrl == "" {
+		*pushgatewayUrl = os.Getenv("PUSHGATEWAY_URL")
+	}
+
+	if *apiAddr == "" {
+		*apiAddr = os.Getenv("API_ADDR")
+	}
+
+	if *configFile == "" {
+		*configFile = os.Getenv("CONFIG_FILE")
+	}
+
+	if *configFile != "" {
+		return loadFile(*configFile, func(c *Config) {
+			if *dataDir != "" {
+				c.DataDir = *dataDir
+			}
+			if *concurrency != 0 {
+				c.Concurrency = *concurrency
+			}
+			if *metricsAddr != "" {
+				c.MetricsAddr = *metricsAddr
+			}
+			if *pushgatewayUrl != "" {
+				c.PushgatewayUrl = *pushgatewayUrl
+			}
+			if *apiAddr != "" {
+				c.ApiAddr = *apiAddr
+			}
+			if c.ApiToken == "" {
+				c.ApiToken = os.Getenv("API_TOKEN")
+			}
+		})
+	}
+
+	c := &Config{
+		DataDir:        *dataDir,
+		Concurrency:    *concurrency,
+		MetricsAddr:    *metricsAddr,
+		PushgatewayUrl: *pushgatewayUrl,
+		ApiAddr:        *apiAddr,
+		ApiToken:       os.Getenv("API_TOKEN"),
+		settingName:    envSettingName,
+	}
+
+	if *atlassianAccount == "" {
+		*atlassianAccount = os.Getenv("ATLASSIAN_ACCOUNT")
 	}
 
 	if *atlassianWorkspace == "" {
-		ws, ok := os.LookupEnv("ATLASSIAN_WORKSPACE")
-		if !ok {
-			log.Fatal("Atlassian workspace is not specified")
-		}
-		*atlassianWorkspace = ws
+		*atlassianWorkspace = os.Getenv("ATLASSIAN_WORKSPACE")
+	}
+
+	if *atlassianUrl == "" {
+		*atlassianUrl = os.Getenv("ATLASSIAN_URL")
 	}
 
 	if *atlassianToken == "" {
-		token, ok := os.LookupEnv("ATLASSIAN_TOKEN")
-		if !ok {
-			log.Fatal("Atlassian token is not specified")
-		}
-		*atlassianToken = token
+		*atlassianToken = os.Getenv("ATLASSIAN_TOKEN")
 	}
 
 	if *backupType == "" {
-		bType, ok := os.LookupEnv("BACKUP_TYPE")
-		if !ok {
-			log.Fatal("Backup type is not specified")
-		}
-		*backupType = bType
+		*backupType = os.Getenv("BACKUP_TYPE")
 	}
 
 	if *storageType == "" {
-		sType, ok := os.LookupEnv("STORAGE_TYPE")
-		if !ok {
-			log.Fatal("Backup type is not specified")
-		}
-		*storageType = sType
+		*storageType = os.Getenv("STORAGE_TYPE")
 	}
 
 	if *notifyType == "" {
-		nType, ok := os.LookupEnv("NOTIFY_TYPE")
-		if !ok {
-			log.Fatal("Notify type is not specified")
+		*notifyType = os.Getenv("NOTIFY_TYPE")
+	}
+
+	if *heartbeatUrl == "" {
+		*heartbeatUrl = os.Getenv("HEARTBEAT_URL")
+	}
+
+	if *schedule == "" {
+		*schedule = os.Getenv("SCHEDULE")
+	}
+
+	if *maxAge == 0 {
+		if age, ok := os.LookupEnv("BACKUP_MAX_AGE"); ok {
+			d, err := time.ParseDuration(age)
+			if err != nil || d <= 0 {
+				c.problems = append(c.problems, Problem{
+					Setting: "BACKUP_MAX_AGE",
+					Message: fmt.Sprintf("Backup max age %q is incorrect", age),
+				})
+			}
+			*maxAge = d
 		}
-		*notifyType = nType
 	}
 
-	if !validateType(backupTypes[:], *backupType) {
-		log.Fatal("Backup type is incorrect")
+	if *lockTtl == 0 {
+		*lockTtl = c.envDuration("LOCK_TTL")
 	}
 
-	if !validateType(storageTypes[:], *storageType) {
-		log.Fatal("Storage type is incorrect")
+	retry := Retry{
+		MaxAttempts:  c.envInt("RETRY_MAX_ATTEMPTS"),
+		InitialDelay: c.envDuration("RETRY_INITIAL_DELAY"),
+		MaxDelay:     c.envDuration("RETRY_MAX_DELAY"),
 	}
 
-	if !validateType(notifyTypes[:], *notifyType) {
-		log.Fatal("Notify type is incorrect")
+	poll := Poll{
+		InitialInterval: c.envDuration("POLL_INITIAL_INTERVAL"),
+		MaxInterval:     c.envDuration("POLL_MAX_INTERVAL"),
+		StallTimeout:    c.envDuration("POLL_STALL_TIMEOUT"),
 	}
 
-	return &Config{
+	timeouts := Timeouts{
+		Run:        c.envDuration("RUN_TIMEOUT"),
+		Generation: c.envDuration("GENERATION_TIMEOUT"),
+		Download:   c.envDuration("DOWNLOAD_TIMEOUT"),
+		Upload:     c.envDuration("UPLOAD_TIMEOUT"),
+	}
+
+	job := Job{
 		AtlassianAccount:   *atlassianAccount,
 		AtlassianWorkspace: *atlassianWorkspace,
+		AtlassianUrl:       *atlassianUrl,
 		AtlassianToken:     *atlassianToken,
 		BackupType:         *backupType,
-		StorageType:        *storageType,
-		NotifyType:         *notifyType,
+		Notifiers:          parseNotifiers(*notifyType),
+		HeartbeatUrl:       *heartbeatUrl,
+		MaxAge:             *maxAge,
+		Schedule:           *schedule,
+		Retry:              retry,
+		Poll:               poll,
+		Timeouts:           timeouts,
+		LockTtl:            *lockTtl,
+	}
+
+	if *storageType != "" {
+		job.Storages = []Storage{{
+			Type:        *storageType,
+			Bucket:      os.Getenv("GS_BUCKET_NAME"),
+			Folder:      os.Getenv("LOCAL_FOLDER"),
+			Credentials: os.Getenv("GS_CREDENTIALS"),
+		}}
+	}
+
+	for i := range job.Notifiers {
+		notifierFromEnv(&job.Notifiers[i])
+	}
+
+	c.Jobs = []Job{job}
+
+	if err := c.prepare(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+/*
+envInt returns integer value of environment variable or zero, if it isn't
+set. Incorrect value is added to configuration problems
+
+Arguments:
+
+	name string
+
+Returns: int
+*/
+func (c *Config) envInt(name string) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return 0
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		c.problems = append(c.problems, Problem{
+			Setting: name,
+			Message: fmt.Sprintf("Value %q is not an integer", value),
+		})
+	}
+	return i
+}
+
+/*
+envDuration returns duration value of environment variable or zero, if it
+isn't set. Incorrect value is added to configuration problems
+
+Arguments:
+
+	name string
+
+Returns: time.Duration
+*/
+func (c *Config) envDuration(name string) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return 0
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		c.problems = append(c.problems, Problem{
+			Setting: name,
+			Message: fmt.Sprintf("Value %q is not a duration", value),
+		})
+	}
+	return d
+}
+
+/*
+parseNotifiers split notifiers list, e.g. "slack,pagerduty:error", to
+Notifier objects. Empty list items are skipped.
+
+Arguments:
+
+	list string
+
+Returns: []Notifier
+*/
+func parseNotifiers(list string) []Notifier {
+	var notifiers []Notifier
+
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		nType, severity, _ := strings.Cut(item, ":")
+		notifiers = append(notifiers, Notifier{
+			Type:        strings.TrimSpace(nType),
+			MinSeverity: strings.ToLower(strings.TrimSpace(severity)),
+		})
+	}
+
+	return notifiers
+}
+
+/*
+notifierFromEnv fill notifier specific settings from environment
+
+Arguments:
+
+	n *Notifier
+*/
+func notifierFromEnv(n *Notifier) {
+	switch n.Type {
+	case "slack":
+		n.WebhookUrl = os.Getenv("SLACK_WEBHOOK_URL")
+	case "pagerduty":
+		n.RoutingKey = os.Getenv("PAGERDUTY_ROUTING_KEY")
+		n.EventsUrl = os.Getenv("PAGERDUTY_EVENTS_URL")
+	case "opsgenie":
+		n.ApiKey = os.Getenv("OPSGENIE_API_KEY")
+		n.ApiUrl = os.Getenv("OPSGENIE_API_URL")
+		n.Priority = os.Getenv("OPSGENIE_PRIORITY")
 	}
 }
 
@@ -0,0 +1,384 @@
+package config
+
+import (
+	"atlassian_backup/lib/utils"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+A file presents YAML configuration file. Settings from defaults are used for
+every job, which doesn't set them itself
+*/
+type file struct {
+	DataDir        string    `yaml:"dataDir"`
+	Concurrency    int       `yaml:"concurrency"`
+	MetricsAddr    string    `yaml:"metricsAddr"`
+	PushgatewayUrl string    `yaml:"pushgatewayUrl"`
+	ApiAddr        string    `yaml:"apiAddr"`
+	ApiToken       string    `yaml:"apiToken"`
+	Defaults       fileJob   `yaml:"defaults"`
+	Jobs           []fileJob `yaml:"jobs"`
+}
+
+type fileJob struct {
+	Name         string         `yaml:"name"`
+	Account      string         `yaml:"account"`
+	Workspace    string         `yaml:"workspace"`
+	Url          string         `yaml:"url"`
+	Token        string         `yaml:"token"`
+	Type         string         `yaml:"type"`
+	Storages     []fileStorage  `yaml:"storages"`
+	Retention    *fileRetention `yaml:"retention"`
+	Notifiers    []fileNotifier `yaml:"notifiers"`
+	HeartbeatUrl string         `yaml:"heartbeatUrl"`
+	MaxAge       time.Duration  `yaml:"maxAge"`
+	Schedule     string         `yaml:"schedule"`
+	Retry        *fileRetry     `yaml:"retry"`
+	Poll         *filePoll      `yaml:"poll"`
+	Timeouts     *fileTimeouts  `yaml:"timeouts"`
+	LockTtl      time.Duration  `yaml:"lockTtl"`
+}
+
+type fileRetry struct {
+	MaxAttempts  int           `yaml:"maxAttempts"`
+	InitialDelay time.Duration `yaml:"initialDelay"`
+	MaxDelay     time.Duration `yaml:"maxDelay"`
+}
+
+type filePoll struct {
+	InitialInterval time.Duration `yaml:"initialInterval"`
+	MaxInterval     time.Duration `yaml:"maxInterval"`
+	StallTimeout    time.Duration `yaml:"stallTimeout"`
+}
+
+type fileTimeouts struct {
+	Run        time.Duration `yaml:"run"`
+	Generation time.Duration `yaml:"generation"`
+	Download   time.Duration `yaml:"download"`
+	Upload     time.Duration `yaml:"upload"`
+}
+
+type fileStorage struct {
+	Type        string `yaml:"type"`
+	Prefix      string `yaml:"prefix"`
+	Bucket      string `yaml:"bucket"`
+	Folder      string `yaml:"folder"`
+	Credentials string `yaml:"credentials"`
+}
+
+type fileRetention struct {
+	Keep   int           `yaml:"keep"`
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+type fileNotifier struct {
+	Type        string `yaml:"type"`
+	MinSeverity string `yaml:"minSeverity"`
+	WebhookUrl  string `yaml:"webhookUrl"`
+	RoutingKey  string `yaml:"routingKey"`
+	EventsUrl   string `yaml:"eventsUrl"`
+	ApiKey      string `yaml:"apiKey"`
+	ApiUrl      string `yaml:"apiUrl"`
+	Priority    string `yaml:"priority"`
+}
+
+/*
+LoadFile reads jobs configuration from YAML file. Environment variables
+references ${VAR} or $VAR in setting values are replaced with their values,
+so secrets may be kept out of the file. Values are replaced after parsing, so
+they don't need YAML escaping and comments aren't expanded. Use $$ for
+literal dollar sign. Secrets may also be set by secret references, e.g.
+vault://secret/data/jira#token.
+
+Example:
+
+	dataDir: /var/lib/atlassian_backup
+	concurrency: 2
+	metricsAddr: :9090
+	apiAddr: :8080
+	apiToken: file:///run/secrets/api_token
+	defaults:
+	  account: backup@example.com
+	  token: file:///run/secrets/atlassian_token
+	  storages:
+	    - type: gs
+	      bucket: atlassian-backups
+	  retention:
+	    keep: 7
+	    maxAge: 720h
+	  schedule: "0 2 * * *"
+	  retry:
+	    maxAttempts: 8
+	    maxDelay: 5m
+	  poll:
+	    initialInterval: 15s
+	    stallTimeout: 90m
+	  timeouts:
+	    generation: 12h
+	    download: 2h
+	  notifiers:
+	    - type: slack
+	      webhookUrl: ${SLACK_WEBHOOK_URL}
+	    - type: pagerduty
+	      minSeverity: error
+	      routingKey: ${PAGERDUTY_ROUTING_KEY}
+	jobs:
+	  - workspace: example
+	    type: jira
+	    storages:
+	      - type: gs
+	        bucket: atlassian-backups
+	        prefix: example/
+	  - workspace: example
+	    type: confluence
+
+Arguments:
+
+	path string
+
+Returns:
+
+	*Config
+	error
+*/
+func LoadFile(path string) (*Config, error) {
+	return loadFile(path, nil)
+}
+
+/*
+loadFile reads jobs configuration from YAML file like LoadFile. Settings
+overridden by command line arguments or environment are set by override
+before configuration is prepared, so they are validated too
+
+Arguments:
+
+	path string
+	override func(c *Config): nil, if nothing is overridden
+
+Returns:
+
+	*Config
+	error
+*/
+func loadFile(path string, override func(c *Config)) (c *Config, err error) {
+	defer func() {
+		err = utils.WrapIfErr("can't load configuration file "+path, err)
+	}()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != 0 {
+		if err := expandEnv(&doc); err != nil {
+			return nil, err
+		}
+		// Expanded document is decoded again to check unknown settings
+		if data, err = yaml.Marshal(&doc); err != nil {
+			return nil, err
+		}
+	}
+
+	var f file
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+
+	c = &Config{
+		DataDir:        f.DataDir,
+		Concurrency:    f.Concurrency,
+		MetricsAddr:    f.MetricsAddr,
+		PushgatewayUrl: f.PushgatewayUrl,
+		ApiAddr:        f.ApiAddr,
+		ApiToken:       f.ApiToken,
+	}
+	for _, fj := range f.Jobs {
+		c.Jobs = append(c.Jobs, fj.job(&f.Defaults))
+	}
+
+	if override != nil {
+		override(c)
+	}
+
+	if err := c.prepare(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+/*
+expandEnv replace environment variables references in setting values of
+parsed document. Mapping keys and comments are left as is. Returns error
+with list of unset variables
+
+Arguments:
+
+	doc *yaml.Node
+
+Returns: error
+*/
+func expandEnv(doc *yaml.Node) error {
+	missing := make(map[string]bool)
+
+	expandNode(doc, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing[name] = true
+		}
+		return v
+	})
+
+	if len(missing) != 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf(
+			"environment variables are not set: %s",
+			strings.Join(names, ", "),
+		)
+	}
+
+	return nil
+}
+
+/*
+expandNode replace variables references in scalar values of node and its
+children. Tag of expanded plain scalar is reset, so its type is resolved by
+expanded value, e.g. concurrency: ${CONCURRENCY} is integer
+
+Arguments:
+
+	n *yaml.Node
+	mapping func(string) string: variable value by name
+*/
+func expandNode(n *yaml.Node, mapping func(string) string) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		v := os.Expand(n.Value, mapping)
+		if v != n.Value {
+			n.Value = v
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			expandNode(n.Content[i], mapping)
+		}
+	default:
+		for _, c := range n.Content {
+			expandNode(c, mapping)
+		}
+	}
+}
+
+/*
+job converts file job to Job, unset settings are taken from defaults
+
+Arguments:
+
+	d *fileJob: defaults
+
+Returns: Job
+*/
+func (fj *fileJob) job(d *fileJob) Job {
+	j := Job{
+		Name:               fj.Name,
+		AtlassianAccount:   orDefault(fj.Account, d.Account),
+		AtlassianWorkspace: orDefault(fj.Workspace, d.Workspace),
+		AtlassianUrl:       orDefault(fj.Url, d.Url),
+		AtlassianToken:     orDefault(fj.Token, d.Token),
+		BackupType:         orDefault(fj.Type, d.Type),
+		HeartbeatUrl:       orDefault(fj.HeartbeatUrl, d.HeartbeatUrl),
+		Schedule:           orDefault(fj.Schedule, d.Schedule),
+		MaxAge:             fj.MaxAge,
+	}
+
+	if j.MaxAge == 0 {
+		j.MaxAge = d.MaxAge
+	}
+
+	j.LockTtl = fj.LockTtl
+	if j.LockTtl == 0 {
+		j.LockTtl = d.LockTtl
+	}
+
+	storages := fj.Storages
+	if storages == nil {
+		storages = d.Storages
+	}
+	for _, s := range storages {
+		j.Storages = append(j.Storages, Storage(s))
+	}
+
+	retention := fj.Retention
+	if retention == nil {
+		retention = d.Retention
+	}
+	if retention != nil {
+		j.Retention = Retention(*retention)
+	}
+
+	retry := fj.Retry
+	if retry == nil {
+		retry = d.Retry
+	}
+	if retry != nil {
+		j.Retry = Retry(*retry)
+	}
+
+	poll := fj.Poll
+	if poll == nil {
+		poll = d.Poll
+	}
+	if poll != nil {
+		j.Poll = Poll(*poll)
+	}
+
+	timeouts := fj.Timeouts
+	if timeouts == nil {
+		timeouts = d.Timeouts
+	}
+	if timeouts != nil {
+		j.Timeouts = Timeouts(*timeouts)
+	}
+
+	notifiers := fj.Notifiers
+	if notifiers == nil {
+		notifiers = d.Notifiers
+	}
+	for _, n := range notifiers {
+		n.MinSeverity = strings.ToLower(n.MinSeverity)
+		j.Notifiers = append(j.Notifiers, Notifier(n))
+	}
+
+	return j
+}
+
+// orDefault returns value or default value, if value is empty
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
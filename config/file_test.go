@@ -0,0 +1,124 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, text string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jobs.yaml")
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const validJobs = `
+dataDir: %DATA%
+defaults:
+  account: backup@example.com
+  storages:
+    - type: local
+      folder: /backups
+  notifiers:
+    - type: slack
+      webhookUrl: https://hooks.example.com/x
+jobs:
+  - workspace: example
+    type: jira
+`
+
+func configFile(t *testing.T, text string) string {
+	return writeConfig(t, strings.Replace(text, "%DATA%", t.TempDir(), 1))
+}
+
+func TestLoadFileExpandsValues(t *testing.T) {
+	t.Setenv("TEST_TOKEN", `se: cret #1 "quoted"`)
+	t.Setenv("TEST_CONCURRENCY", "3")
+
+	c, err := LoadFile(configFile(t, `
+# Atlassian costs $5 per $USER, comments aren't expanded
+concurrency: ${TEST_CONCURRENCY}
+`+validJobs+`    token: ${TEST_TOKEN}
+    storages:
+      - type: local
+        folder: "/backups/$$literal"
+`))
+	if err != nil {
+		t.Fatalf("LoadFile error: %v", err)
+	}
+
+	if c.Concurrency != 3 {
+		t.Errorf("concurrency = %d, want 3", c.Concurrency)
+	}
+	j := c.Jobs[0]
+	if j.AtlassianToken != `se: cret #1 "quoted"` {
+		t.Errorf("token = %q", j.AtlassianToken)
+	}
+	if j.Storages[0].Folder != "/backups/$literal" {
+		t.Errorf("folder = %q", j.Storages[0].Folder)
+	}
+}
+
+func TestLoadFileMissingVariables(t *testing.T) {
+	_, err := LoadFile(configFile(t, validJobs+`    token: ${TEST_UNSET_B}
+    heartbeatUrl: $TEST_UNSET_A
+`))
+	if err == nil {
+		t.Fatal("LoadFile with unset variables: no error")
+	}
+	if !strings.Contains(err.Error(), "environment variables are not set: TEST_UNSET_A, TEST_UNSET_B") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestLoadFileUnknownSetting(t *testing.T) {
+	t.Setenv("TEST_TOKEN", "token")
+
+	_, err := LoadFile(configFile(t, validJobs+`    token: ${TEST_TOKEN}
+    tokn: typo
+`))
+	if err == nil || !strings.Contains(err.Error(), "tokn") {
+		t.Errorf("error = %v, want unknown field tokn", err)
+	}
+}
+
+func TestLoadFileOverride(t *testing.T) {
+	path := configFile(t, validJobs+`    token: secret
+`)
+
+	// API enabled by override must have token
+	_, err := loadFile(path, func(c *Config) {
+		c.ApiAddr = ":8080"
+	})
+	var ve *ValidationError
+	if !errors.As(err, &ve) || !strings.Contains(err.Error(), "apiToken") {
+		t.Fatalf("loadFile error = %v, want apiToken problem", err)
+	}
+
+	// Overridden token is resolved like file setting
+	t.Setenv("TEST_API_TOKEN", "api-secret")
+	c, err := loadFile(path, func(c *Config) {
+		c.ApiAddr = ":8080"
+		c.ApiToken = "env://TEST_API_TOKEN"
+		c.Concurrency = 2
+	})
+	if err != nil {
+		t.Fatalf("loadFile error: %v", err)
+	}
+	if c.ApiAddr != ":8080" || c.ApiToken != "api-secret" || c.Concurrency != 2 {
+		t.Errorf("config = %+v", c)
+	}
+
+	_, err = loadFile(path, func(c *Config) {
+		c.Concurrency = -1
+	})
+	if !errors.As(err, &ve) {
+		t.Errorf("loadFile with negative concurrency error = %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"atlassian_backup/lib/secret"
+	"atlassian_backup/lib/utils"
+	"fmt"
+)
+
+/*
+resolveSecrets replaces secret references (file://, env://, vault://,
+gcpsm://) in tokens, keys, webhook URLs and storage credentials with secret
+values. Unresolved references are added to configuration problems. Secret
+values are registered for redaction from logs, errors and notifications
+*/
+func (c *Config) resolveSecrets() {
+	r := secret.NewResolver()
+
+	resolve := func(job, setting string, value *string) {
+		v, err := r.Resolve(*value)
+		if err != nil {
+			if c.settingName != nil {
+				setting = c.settingName(setting)
+			}
+			c.problems = append(c.problems, Problem{
+				Job:     job,
+				Setting: setting,
+				Message: err.Error(),
+			})
+			return
+		}
+		*value = v
+		utils.AddSecret(v)
+	}
+
+	resolve("", "apiToken", &c.ApiToken)
+
+	for i := range c.Jobs {
+		j := &c.Jobs[i]
+
+		resolve(j.Name, "token", &j.AtlassianToken)
+		resolve(j.Name, "heartbeatUrl", &j.HeartbeatUrl)
+
+		for k := range j.Storages {
+			setting := fmt.Sprintf("storages[%d]", k)
+			resolve(j.Name, setting+".credentials", &j.Storages[k].Credentials)
+		}
+
+		for k := range j.Notifiers {
+			n := &j.Notifiers[k]
+			setting := fmt.Sprintf("notifiers[%d]", k)
+
+			resolve(j.Name, setting+".webhookUrl", &n.WebhookUrl)
+			resolve(j.Name, setting+".routingKey", &n.RoutingKey)
+			resolve(j.Name, setting+".apiKey", &n.ApiKey)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package config
+
+import (
+	"atlassian_backup/lib/utils"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// A Problem presents one missing or incorrect setting of a job
+type Problem struct {
+	Job     string
+	Setting string
+	Message string
+}
+
+// String returns problem description with job and setting names
+func (p Problem) String() string {
+	var b strings.Builder
+
+	if p.Job != "" {
+		b.WriteString(p.Job + ": ")
+	}
+	b.WriteString(p.Message)
+	if p.Setting != "" {
+		b.WriteString(" (" + p.Setting + ")")
+	}
+
+	return b.String()
+}
+
+// A ValidationError presents all problems found in configuration
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Error returns all problems descriptions, one per line
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf(
+		"configuration is invalid, %d problem(s) found:",
+		len(e.Problems),
+	))
+
+	for _, p := range e.Problems {
+		lines = append(lines, "\t"+p.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// envSettings maps settings to environment variables and flags names
+var envSettings = map[string]string{
+	"account":                 "ATLASSIAN_ACCOUNT or -atlassianAccount",
+	"workspace":               "ATLASSIAN_WORKSPACE or -atlassianWorkspace",
+	"url":                     "ATLASSIAN_URL or -atlassianUrl",
+	"token":                   "ATLASSIAN_TOKEN or -atlassianToken",
+	"type":                    "BACKUP_TYPE or -backupType",
+	"storages":                "STORAGE_TYPE or -storageType",
+	"storages[].type":         "STORAGE_TYPE or -storageType",
+	"storages[].bucket":       "GS_BUCKET_NAME",
+	"storages[].folder":       "LOCAL_FOLDER",
+	"storages[].credentials":  "GS_CREDENTIALS",
+	"heartbeatUrl":            "HEARTBEAT_URL or -heartbeatUrl",
+	"notifiers":               "NOTIFY_TYPE or -notifyType",
+	"notifiers[].type":        "NOTIFY_TYPE or -notifyType",
+	"notifiers[].minSeverity": "NOTIFY_TYPE or -notifyType",
+	"notifiers[].webhookUrl":  "SLACK_WEBHOOK_URL",
+	"notifiers[].routingKey":  "PAGERDUTY_ROUTING_KEY",
+	"notifiers[].apiKey":      "OPSGENIE_API_KEY",
+	"maxAge":                  "BACKUP_MAX_AGE or -maxAge",
+	"schedule":                "SCHEDULE or -schedule",
+	"retry":                   "RETRY_MAX_ATTEMPTS, RETRY_INITIAL_DELAY or RETRY_MAX_DELAY",
+	"lockTtl":                 "LOCK_TTL or -lockTtl",
+	"poll":                    "POLL_INITIAL_INTERVAL, POLL_MAX_INTERVAL or POLL_STALL_TIMEOUT",
+	"timeouts":                "RUN_TIMEOUT, GENERATION_TIMEOUT, DOWNLOAD_TIMEOUT or UPLOAD_TIMEOUT",
+	"apiToken":                "API_TOKEN",
+	"concurrency":             "CONCURRENCY or -concurrency",
+}
+
+var settingIndexRegex = regexp.MustCompile(`\[[0-9]+\]`)
+
+/*
+envSettingName converts configuration file setting name to environment
+variable and flag names
+
+Arguments:
+
+	setting string
+
+Returns: string
+*/
+func envSettingName(setting string) string {
+	if name, ok := envSettings[settingIndexRegex.ReplaceAllString(setting, "[]")]; ok {
+		return name
+	}
+	return setting
+}
+
+/*
+prepare sets default values, resolves secrets and validates configuration
+
+Returns: error
+*/
+func (c *Config) prepare() error {
+	c.setDefaults()
+	c.resolveSecrets()
+	return c.validate()
+}
+
+/*
+setDefaults sets data folder, job names, Atlassian site URLs, max backup age, retry policy,
+progress polling, phases timeouts and lock TTL, if they aren't specified
+*/
+func (c *Config) setDefaults() {
+	if c.DataDir == "" {
+		c.DataDir = defaultDataDir
+	}
+
+	for i := range c.Jobs {
+		j := &c.Jobs[i]
+
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("job %d", i+1)
+			if j.AtlassianWorkspace != "" && j.BackupType != "" {
+				j.Name = j.AtlassianWorkspace + "-" + j.BackupType
+			}
+		}
+
+		if j.AtlassianUrl == "" && j.AtlassianWorkspace != "" {
+			j.AtlassianUrl = "https://" + j.AtlassianWorkspace + ".atlassian.net"
+		}
+
+		if j.MaxAge == 0 {
+			j.MaxAge = defaultMaxAge
+		}
+
+		if j.LockTtl == 0 {
+			j.LockTtl = defaultLockTtl
+		}
+
+		if j.Retry.MaxAttempts == 0 {
+			j.Retry.MaxAttempts = utils.DefaultRetryPolicy.MaxAttempts
+		}
+		if j.Retry.InitialDelay == 0 {
+			j.Retry.InitialDelay = utils.DefaultRetryPolicy.InitialDelay
+		}
+		if j.Retry.MaxDelay == 0 {
+			j.Retry.MaxDelay = utils.DefaultRetryPolicy.MaxDelay
+		}
+
+		if j.Poll.InitialInterval == 0 {
+			j.Poll.InitialInterval = defaultPollInitialInterval
+		}
+		if j.Poll.MaxInterval == 0 {
+			j.Poll.MaxInterval = max(defaultPollMaxInterval, j.Poll.InitialInterval)
+		}
+		if j.Poll.StallTimeout == 0 {
+			j.Poll.StallTimeout = defaultPollStallTimeout
+		}
+
+		if j.Timeouts.Generation == 0 {
+			j.Timeouts.Generation = defaultGenerationTimeout
+		}
+		if j.Timeouts.Download == 0 {
+			j.Timeouts.Download = defaultDownloadTimeout
+		}
+		if j.Timeouts.Upload == 0 {
+			j.Timeouts.Upload = defaultUploadTimeout
+		}
+	}
+}
+
+/*
+validate checks jobs settings. Returns *ValidationError with all found
+problems
+
+Returns: error
+*/
+func (c *Config) validate() error {
+	problems := c.problems
+
+	add := func(job, setting, format string, args ...any) {
+		if c.settingName != nil {
+			setting = c.settingName(setting)
+		}
+		problems = append(problems, Problem{
+			Job:     job,
+			Setting: setting,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(c.Jobs) == 0 {
+		add("", "jobs", "No backup jobs are specified")
+	}
+
+	if c.Concurrency < 0 {
+		add("", "concurrency", "Concurrency must not be negative")
+	}
+
+	if c.ApiAddr != "" && c.ApiToken == "" {
+		add("", "apiToken", "API token is not specified")
+	}
+
+	names := make(map[string]bool, len(c.Jobs))
+	// targets maps storage target of workspace backups to job, which saves
+	// backups there, retention of another job would remove them
+	targets := make(map[string]string)
+
+	for i := range c.Jobs {
+		j := &c.Jobs[i]
+
+		if names[j.Name] {
+			add(j.Name, "name", "Job name is duplicated")
+		}
+		names[j.Name] = true
+
+		if j.AtlassianAccount == "" {
+			add(j.Name, "account", "Atlassian account is not specified")
+		}
+		if j.AtlassianWorkspace == "" {
+			add(j.Name, "workspace", "Atlassian workspace is not specified")
+		}
+		if j.AtlassianToken == "" {
+			add(j.Name, "token", "Atlassian token is not specified")
+		}
+		if u, err := url.Parse(j.AtlassianUrl); j.AtlassianUrl != "" &&
+			(err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			add(j.Name, "url", "Atlassian URL %q is incorrect", j.AtlassianUrl)
+		}
+
+		if j.BackupType == "" {
+			add(j.Name, "type", "Backup type is not specified")
+		} else if !validateType(backupTypes[:], j.BackupType) {
+			add(j.Name, "type", "Backup type %q is incorrect", j.BackupType)
+		}
+
+		if len(j.Storages) == 0 {
+			add(j.Name, "storages", "Storage type is not specified")
+		}
+		for k, s := range j.Storages {
+			setting := fmt.Sprintf("storages[%d]", k)
+
+			switch s.Type {
+			case "gs":
+				if s.Bucket == "" {
+					add(j.Name, setting+".bucket", "GS bucket is not specified")
+				}
+			case "local":
+				if s.Folder == "" {
+					add(j.Name, setting+".folder", "Local folder is not specified")
+				}
+			default:
+				add(j.Name, setting+".type", "Storage type %q is incorrect", s.Type)
+			}
+
+			target := storageTarget(j, s)
+			if other, ok := targets[target]; ok && other != j.Name {
+				add(
+					j.Name,
+					setting,
+					"Job %s saves %s backups of the same workspace to the same storage",
+					other,
+					j.BackupType,
+				)
+			}
+			targets[target] = j.Name
+		}
+
+		if j.Schedule != "" {
+			if _, err := cron.ParseStandard(j.Schedule); err != nil {
+				add(j.Name, "schedule", "Schedule is incorrect: %v", err)
+			}
+		}
+
+		if j.Retry.MaxAttempts < 0 || j.Retry.InitialDelay < 0 || j.Retry.MaxDelay < 0 {
+			add(j.Name, "retry", "Retry policy is incorrect")
+		}
+
+		if j.Poll.InitialInterval < time.Second ||
+			j.Poll.MaxInterval < j.Poll.InitialInterval ||
+			j.Poll.StallTimeout < 0 {
+			add(
+				j.Name,
+				"poll",
+				"Polling intervals must be at least 1s, max interval must not be less than initial one",
+			)
+		}
+
+		if j.Timeouts.Run < 0 || j.Timeouts.Generation < 0 ||
+			j.Timeouts.Download < 0 || j.Timeouts.Upload < 0 {
+			add(j.Name, "timeouts", "Timeouts must not be negative")
+		}
+
+		if j.LockTtl < time.Minute {
+			add(j.Name, "lockTtl", "Lock TTL must be at least 1m")
+		}
+
+		if j.Retention.Keep < 0 || j.Retention.MaxAge < 0 {
+			add(j.Name, "retention", "Retention is incorrect")
+		}
+
+		if len(j.Notifiers) == 0 {
+			add(j.Name, "notifiers", "Notify type is not specified")
+		}
+		for k, n := range j.Notifiers {
+			setting := fmt.Sprintf("notifiers[%d]", k)
+
+			switch n.Type {
+			case "slack":
+				if n.WebhookUrl == "" {
+					add(
+						j.Name,
+						setting+".webhookUrl",
+						"Slack webhook URL is not specified",
+					)
+				}
+			case "pagerduty":
+				if n.RoutingKey == "" {
+					add(
+						j.Name,
+						setting+".routingKey",
+						"PagerDuty routing key is not specified",
+					)
+				}
+			case "opsgenie":
+				if n.ApiKey == "" {
+					add(
+						j.Name,
+						setting+".apiKey",
+						"Opsgenie API key is not specified",
+					)
+				}
+			default:
+				add(j.Name, setting+".type", "Notify type %q is incorrect", n.Type)
+			}
+
+			if n.MinSeverity != "" && !validateType(severities[:], n.MinSeverity) {
+				add(
+					j.Name,
+					setting+".minSeverity",
+					"Notify severity %q is incorrect",
+					n.MinSeverity,
+				)
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+/*
+storageTarget returns key of folder or bucket prefix, where storage target
+keeps backups of job workspace and backup type
+
+Arguments:
+
+	j *Job
+	s Storage
+
+Returns: string
+*/
+func storageTarget(j *Job, s Storage) string {
+	location := filepath.Clean(s.Folder)
+	if s.Type == "gs" {
+		location = s.Bucket
+	}
+	return strings.Join([]string{
+		s.Type,
+		location,
+		filepath.Join("/", s.Prefix),
+		j.AtlassianWorkspace,
+		j.BackupType,
+	}, "\x00")
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validJob returns job, which passes validation
+func validJob(workspace, backupType string) Job {
+	return Job{
+		AtlassianAccount:   "backup@example.com",
+		AtlassianWorkspace: workspace,
+		AtlassianToken:     "atlassian-test-token",
+		BackupType:         backupType,
+		Storages:           []Storage{{Type: "local", Folder: "/backups"}},
+		Notifiers:          []Notifier{{Type: "slack", WebhookUrl: "https://hooks.example.com/x"}},
+	}
+}
+
+func TestSharedStorageTarget(t *testing.T) {
+	// Workspaces and backup types are kept apart in shared folder
+	c := &Config{Jobs: []Job{
+		validJob("a", "jira"),
+		validJob("b", "jira"),
+		validJob("a", "confluence"),
+	}}
+	if err := c.prepare(); err != nil {
+		t.Fatalf("prepare error: %v", err)
+	}
+
+	nightly := validJob("a", "jira")
+	nightly.Name = "nightly"
+	weekly := validJob("a", "jira")
+	weekly.Name = "weekly"
+	weekly.Storages = []Storage{
+		{Type: "local", Folder: "/other"},
+		{Type: "local", Folder: "/backups/"},
+	}
+
+	c = &Config{Jobs: []Job{nightly, weekly}}
+	err := c.prepare()
+
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Problems) != 1 {
+		t.Fatalf("prepare error = %v, want one problem", err)
+	}
+	p := ve.Problems[0]
+	if p.Job != "weekly" || p.Setting != "storages[1]" || !strings.Contains(p.Message, "nightly") {
+		t.Errorf("problem = %+v", p)
+	}
+}
+
+// brokenConfig returns configuration with every kind of problem
+func brokenConfig() *Config {
+	broken := Job{
+		Name:         "broken",
+		AtlassianUrl: "ftp://example.atlassian.net",
+		BackupType:   "bitbucket",
+		Storages:     []Storage{{Type: "gs"}, {Type: "s3"}},
+		Schedule:     "every day",
+		Retry:        Retry{MaxAttempts: -1},
+		Poll:         Poll{InitialInterval: 10 * time.Millisecond},
+		Timeouts:     Timeouts{Run: -time.Minute},
+		LockTtl:      10 * time.Second,
+		Retention:    Retention{Keep: -1},
+		Notifiers: []Notifier{
+			{Type: "pagerduty", MinSeverity: "loud"},
+			{Type: "opsgenie"},
+			{Type: "slack"},
+		},
+	}
+
+	duplicate := validJob("example", "")
+	duplicate.Name = "broken"
+	duplicate.Storages = nil
+	duplicate.Notifiers = nil
+
+	return &Config{
+		Concurrency: -1,
+		ApiAddr:     ":8080",
+		Jobs:        []Job{broken, duplicate},
+	}
+}
+
+// brokenProblems are problems of brokenConfig in order of validation
+var brokenProblems = []struct {
+	job, setting, envSetting string
+}{
+	{"", "concurrency", "CONCURRENCY or -concurrency"},
+	{"", "apiToken", "API_TOKEN"},
+	{"broken", "account", "ATLASSIAN_ACCOUNT or -atlassianAccount"},
+	{"broken", "workspace", "ATLASSIAN_WORKSPACE or -atlassianWorkspace"},
+	{"broken", "token", "ATLASSIAN_TOKEN or -atlassianToken"},
+	{"broken", "url", "ATLASSIAN_URL or -atlassianUrl"},
+	{"broken", "type", "BACKUP_TYPE or -backupType"},
+	{"broken", "storages[0].bucket", "GS_BUCKET_NAME"},
+	{"broken", "storages[1].type", "STORAGE_TYPE or -storageType"},
+	{"broken", "schedule", "SCHEDULE or -schedule"},
+	{"broken", "retry", "RETRY_MAX_ATTEMPTS, RETRY_INITIAL_DELAY or RETRY_MAX_DELAY"},
+	{"broken", "poll", "POLL_INITIAL_INTERVAL, POLL_MAX_INTERVAL or POLL_STALL_TIMEOUT"},
+	{"broken", "timeouts", "RUN_TIMEOUT, GENERATION_TIMEOUT, DOWNLOAD_TIMEOUT or UPLOAD_TIMEOUT"},
+	{"broken", "lockTtl", "LOCK_TTL or -lockTtl"},
+	{"broken", "retention", "retention"},
+	{"broken", "notifiers[0].routingKey", "PAGERDUTY_ROUTING_KEY"},
+	{"broken", "notifiers[0].minSeverity", "NOTIFY_TYPE or -notifyType"},
+	{"broken", "notifiers[1].apiKey", "OPSGENIE_API_KEY"},
+	{"broken", "notifiers[2].webhookUrl", "SLACK_WEBHOOK_URL"},
+	// The second job with the same name
+	{"broken", "name", "name"},
+	{"broken", "type", "BACKUP_TYPE or -backupType"},
+	{"broken", "storages", "STORAGE_TYPE or -storageType"},
+	{"broken", "notifiers", "NOTIFY_TYPE or -notifyType"},
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		settingName func(string) string
+	}{
+		{"file", nil},
+		{"env", envSettingName},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := brokenConfig()
+			c.settingName = tc.settingName
+			err := c.prepare()
+
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("prepare error = %v, want *ValidationError", err)
+			}
+
+			got := make([]string, 0, len(ve.Problems))
+			for _, p := range ve.Problems {
+				got = append(got, p.Job+": "+p.Setting)
+			}
+			want := make([]string, 0, len(brokenProblems))
+			for _, p := range brokenProblems {
+				setting := p.setting
+				if tc.settingName != nil {
+					setting = p.envSetting
+				}
+				want = append(want, p.job+": "+setting)
+			}
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Fatalf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+
+			// Error lists every problem on its own line after the summary
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(brokenProblems)+1 ||
+				!strings.Contains(lines[0], "23 problem(s) found") {
+				t.Errorf("error text:\n%s", err)
+			}
+		})
+	}
+}
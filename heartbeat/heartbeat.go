@@ -0,0 +1,68 @@
+/*
+Package heartbeat implements pings to healthchecks.io-style monitoring
+service (dead man's switch). The service alerts, if run doesn't report
+success in time, e.g. when cron job stops running at all.
+
+Ping URLs:
+
+	<url>/start: run is started
+	<url>: run is finished successfully
+	<url>/fail: run is failed
+*/
+package heartbeat
+
+import (
+	"atlassian_backup/lib/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// An Event presents run state, which is reported to monitoring service
+type Event string
+
+const (
+	Start   Event = "start"
+	Success Event = ""
+	Fail    Event = "fail"
+)
+
+const pingTimeout = 10 * time.Second
+
+/*
+Ping reports run event to monitoring service. Text is sent as request body
+and usually shown in service event log.
+
+Arguments:
+
+	baseUrl string: check ping URL
+	e Event
+	text string
+
+Returns: error
+*/
+func Ping(baseUrl string, e Event, text string) (err error) {
+	defer func() { err = utils.WrapIfErr("can't send heartbeat ping", err) }()
+
+	pingUrl := strings.TrimSuffix(baseUrl, "/")
+	if e != Success {
+		pingUrl += "/" + string(e)
+	}
+
+	c := http.Client{
+		Timeout: pingTimeout,
+	}
+
+	resp, err := c.Post(pingUrl, "text/plain", strings.NewReader(text))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+
+	return nil
+}
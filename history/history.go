@@ -0,0 +1,184 @@
+/*
+Package history implements append-only store of finished backup runs.
+
+Every finished run is appended as one JSON line to history file in
+application data folder, so outcome of runs, backup sizes and failures are
+kept after process exits, e.g. for history command, dashboard and size
+growth trends. Interrupted run, which is resumed later, has several records
+with the same run ID.
+*/
+package history
+
+import (
+	"atlassian_backup/lib/utils"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const fileName = "history.jsonl"
+
+// Run outcomes
+const (
+	Success   = "success"
+	Failure   = "failure"
+	Cancelled = "cancelled"
+)
+
+// mu serializes appends of concurrent runs of the process
+var mu sync.Mutex
+
+// A Target presents backup file saved to one storage target
+type Target struct {
+	Storage   string `json:"storage"`
+	Object    string `json:"object"`
+	SizeBytes int64  `json:"sizeBytes,omitempty"`
+	Saved     bool   `json:"saved"`
+}
+
+/*
+A Record presents finished run. FailedPhase is pipeline phase, in which run
+failed or was cancelled. SizeBytes is backup file size, if it's saved
+*/
+type Record struct {
+	RunId        string    `json:"runId"`
+	Job          string    `json:"job"`
+	Workspace    string    `json:"workspace"`
+	BackupType   string    `json:"type"`
+	DownloadOnly bool      `json:"downloadOnly,omitempty"`
+	Started      time.Time `json:"started"`
+	Finished     time.Time `json:"finished"`
+	Outcome      string    `json:"outcome"`
+	FailedPhase  string    `json:"failedPhase,omitempty"`
+	SizeBytes    int64     `json:"sizeBytes,omitempty"`
+	TaskId       string    `json:"taskId,omitempty"`
+	Targets      []Target  `json:"targets,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Duration returns run duration
+func (r *Record) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+/*
+A Filter selects records. Zero fields don't filter, Limit keeps the latest
+records only
+*/
+type Filter struct {
+	Job       string
+	Workspace string
+	Outcome   string
+	Since     time.Time
+	Limit     int
+}
+
+// match reports whether record matches filter
+func (f *Filter) match(r *Record) bool {
+	return (f.Job == "" || r.Job == f.Job) &&
+		(f.Workspace == "" || r.Workspace == f.Workspace) &&
+		(f.Outcome == "" || r.Outcome == f.Outcome) &&
+		(f.Since.IsZero() || !r.Started.Before(f.Since))
+}
+
+/*
+Append adds record to history file of data folder. Returns error if failure
+
+Arguments:
+
+	dataDir string: application data folder
+	r *Record
+
+Returns: error
+*/
+func Append(dataDir string, r *Record) (err error) {
+	defer func() { err = utils.WrapIfErr("can't save run history", err) }()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(
+		filepath.Join(dataDir, fileName),
+		os.O_CREATE|os.O_APPEND|os.O_WRONLY,
+		0600,
+	)
+	if err != nil {
+		return err
+	}
+
+	// One write per record, so lines of concurrent processes aren't mixed
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+/*
+Read returns records of history file, which match filter, the latest first.
+Missing file means empty history. Corrupted lines, e.g. partially written by
+crashed process, are skipped
+
+Arguments:
+
+	dataDir string: application data folder
+	f Filter
+
+Returns:
+
+	records []Record
+	err error
+*/
+func Read(dataDir string, f Filter) (records []Record, err error) {
+	defer func() { err = utils.WrapIfErr("can't read run history", err) }()
+
+	file, err := os.Open(filepath.Join(dataDir, fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if f.match(&r) {
+			records = append(records, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Started.After(records[j].Started)
+	})
+
+	if f.Limit > 0 && len(records) > f.Limit {
+		records = records[:f.Limit]
+	}
+
+	return records, nil
+}
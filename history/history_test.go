@@ -0,0 +1,185 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+
+// record returns finished run record started minutes after t0
+func record(id, job, outcome string, minutes int) *Record {
+	started := t0.Add(time.Duration(minutes) * time.Minute)
+	return &Record{
+		RunId:      id,
+		Job:        job,
+		Workspace:  "example",
+		BackupType: "jira",
+		Started:    started,
+		Finished:   started.Add(time.Minute),
+		Outcome:    outcome,
+	}
+}
+
+// runIds returns run IDs of records
+func runIds(records []Record) []string {
+	ids := make([]string, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.RunId)
+	}
+	return ids
+}
+
+func TestAppendRead(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+
+	saved := record("1", "nightly", Success, 0)
+	saved.SizeBytes = 22
+	saved.TaskId = "10000"
+	saved.Targets = []Target{{Storage: "local", Object: "example/Jira/Cloud/x.tar.gz", SizeBytes: 22, Saved: true}}
+
+	// Data folder is created by the first record
+	for _, r := range []*Record{
+		saved,
+		record("2", "nightly", Failure, 10),
+		record("3", "weekly", Cancelled, 5),
+	} {
+		if err := Append(dir, r); err != nil {
+			t.Fatalf("Append error: %v", err)
+		}
+	}
+
+	records, err := Read(dir, Filter{})
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if got := runIds(records); !reflect.DeepEqual(got, []string{"2", "3", "1"}) {
+		t.Fatalf("records %v, want the latest first", got)
+	}
+	if !reflect.DeepEqual(records[2], *saved) {
+		t.Errorf("record = %+v, want %+v", records[2], *saved)
+	}
+	if records[2].Duration() != time.Minute {
+		t.Errorf("duration = %s, want 1m", records[2].Duration())
+	}
+}
+
+func TestReadFilter(t *testing.T) {
+	dir := t.TempDir()
+	for i, r := range []*Record{
+		record("1", "nightly", Success, 0),
+		record("2", "nightly", Failure, 10),
+		record("3", "weekly", Success, 20),
+		record("4", "nightly", Success, 30),
+	} {
+		if i == 2 {
+			r.Workspace = "other"
+		}
+		if err := Append(dir, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{"4", "3", "2", "1"}},
+		{"job", Filter{Job: "nightly"}, []string{"4", "2", "1"}},
+		{"workspace", Filter{Workspace: "other"}, []string{"3"}},
+		{"outcome", Filter{Outcome: Success}, []string{"4", "3", "1"}},
+		{"since", Filter{Since: t0.Add(10 * time.Minute)}, []string{"4", "3", "2"}},
+		{"limit", Filter{Limit: 2}, []string{"4", "3"}},
+		{"limit after filter", Filter{Job: "nightly", Limit: 2}, []string{"4", "2"}},
+		{"limit above count", Filter{Limit: 10}, []string{"4", "3", "2", "1"}},
+		{"no match", Filter{Job: "hourly"}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := Read(dir, tc.filter)
+			if err != nil {
+				t.Fatalf("Read error: %v", err)
+			}
+			if got := runIds(records); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("records %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadMissing(t *testing.T) {
+	records, err := Read(t.TempDir(), Filter{})
+	if err != nil || len(records) != 0 {
+		t.Errorf("Read = %v, %v, want empty history", records, err)
+	}
+}
+
+func TestReadSkipsCorruptedLines(t *testing.T) {
+	dir := t.TempDir()
+	if err := Append(dir, record("1", "nightly", Success, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Line partially written by crashed process
+	file, err := os.OpenFile(filepath.Join(dir, fileName), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"runId":"2","job":"nigh` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	if err := Append(dir, record("3", "nightly", Success, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Read(dir, Filter{})
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if got := runIds(records); !reflect.DeepEqual(got, []string{"3", "1"}) {
+		t.Errorf("records %v, want 3, 1", got)
+	}
+}
+
+func TestConcurrentAppend(t *testing.T) {
+	dir := t.TempDir()
+
+	// Long records would be interleaved without serialized appends
+	const runs = 50
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := record(fmt.Sprint(i), "nightly", Failure, i)
+			r.Error = fmt.Sprintf("%08000d", i)
+			if err := Append(dir, r); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	records, err := Read(dir, Filter{})
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if len(records) != runs {
+		t.Fatalf("%d records are read, want %d", len(records), runs)
+	}
+	for i, r := range records {
+		if want := fmt.Sprint(runs - 1 - i); r.RunId != want {
+			t.Errorf("record %d run ID = %s, want %s", i, r.RunId, want)
+		}
+		if r.Error != fmt.Sprintf("%08000d", runs-1-i) {
+			t.Errorf("record %s error is mixed with another one", r.RunId)
+		}
+	}
+}
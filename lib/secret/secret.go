@@ -0,0 +1,284 @@
+/*
+Package secret implements resolving of secret references, so tokens and keys
+don't have to be passed in plain environment variables or command-line flags.
+
+Supported references:
+
+	file:///path/to/file: file content without trailing line breaks
+	env://NAME: environment variable value
+	vault://path#key: key of HashiCorp Vault secret (KV v1 or v2), e.g.
+	vault://secret/data/atlassian#token
+	gcpsm://projects/PROJECT/secrets/NAME[/versions/VERSION]: Google Cloud
+	Secret Manager secret version, latest by default
+
+Any other value is returned as is.
+
+Vault environment:
+
+	VAULT_ADDR: Vault server address, e.g. https://vault.example.com:8200
+	VAULT_TOKEN: Vault access token
+	VAULT_NAMESPACE: optional Vault Enterprise namespace
+
+Google Cloud Secret Manager uses application default credentials.
+*/
+package secret
+
+import (
+	"atlassian_backup/lib/utils"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	fileScheme  = "file://"
+	envScheme   = "env://"
+	vaultScheme = "vault://"
+	gcpsmScheme = "gcpsm://"
+
+	secretManagerUrl   = "https://secretmanager.googleapis.com/v1/"
+	secretManagerScope = "https://www.googleapis.com/auth/cloud-platform"
+	requestTimeout     = 30 * time.Second
+)
+
+/*
+A Resolver resolves secret references. Vault secrets are cached, so several
+keys of the same secret are read by one request
+*/
+type Resolver struct {
+	client *http.Client
+	vault  map[string]map[string]any
+}
+
+type vaultResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []string       `json:"errors"`
+}
+
+type secretManagerResponse struct {
+	Payload struct {
+		Data string `json:"data"`
+	} `json:"payload"`
+}
+
+// NewResolver returns new Resolver object
+func NewResolver() *Resolver {
+	return &Resolver{
+		client: &http.Client{
+			Timeout: requestTimeout,
+		},
+		vault: make(map[string]map[string]any),
+	}
+}
+
+// IsReference reports whether value is a secret reference
+func IsReference(value string) bool {
+	for _, scheme := range []string{fileScheme, envScheme, vaultScheme, gcpsmScheme} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Resolve returns secret value for reference or value itself, if it isn't a
+reference. Returns error if secret can't be read.
+
+Arguments:
+
+	ref string
+
+Returns:
+
+	string
+	error
+*/
+func (r *Resolver) Resolve(ref string) (value string, err error) {
+	switch {
+	case strings.HasPrefix(ref, fileScheme):
+		value, err = r.file(strings.TrimPrefix(ref, fileScheme))
+	case strings.HasPrefix(ref, envScheme):
+		value, err = r.env(strings.TrimPrefix(ref, envScheme))
+	case strings.HasPrefix(ref, vaultScheme):
+		value, err = r.vaultKey(strings.TrimPrefix(ref, vaultScheme))
+	case strings.HasPrefix(ref, gcpsmScheme):
+		value, err = r.secretManager(strings.TrimPrefix(ref, gcpsmScheme))
+	default:
+		return ref, nil
+	}
+
+	if err != nil {
+		return "", utils.Wrap("can't resolve secret "+redact(ref), err)
+	}
+	return value, nil
+}
+
+// file reads secret from file
+func (r *Resolver) file(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// env reads secret from environment variable
+func (r *Resolver) env(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// vaultKey reads key of Vault secret, reference format is path#key
+func (r *Resolver) vaultKey(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", errors.New("vault reference must be in path#key format")
+	}
+
+	data, ok := r.vault[path]
+	if !ok {
+		var err error
+		data, err = r.readVault(path)
+		if err != nil {
+			return "", err
+		}
+		r.vault[path] = data
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s is not found in vault secret %s", key, path)
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("key %s of vault secret %s is not a string", key, path)
+	}
+	return s, nil
+}
+
+// readVault reads secret data from Vault. KV v2 nested data is unwrapped
+func (r *Resolver) readVault(path string) (map[string]any, error) {
+	addr, ok := os.LookupEnv("VAULT_ADDR")
+	if !ok {
+		return nil, errors.New("VAULT_ADDR is not set")
+	}
+	token, ok := os.LookupEnv("VAULT_TOKEN")
+	if !ok {
+		return nil, errors.New("VAULT_TOKEN is not set")
+	}
+
+	req, err := http.NewRequest(
+		http.MethodGet,
+		strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("X-Vault-Token", token)
+	if ns, ok := os.LookupEnv("VAULT_NAMESPACE"); ok {
+		req.Header.Add("X-Vault-Namespace", ns)
+	}
+
+	data, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp vaultResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+
+	if nested, ok := resp.Data["data"].(map[string]any); ok {
+		if _, ok := resp.Data["metadata"]; ok {
+			return nested, nil
+		}
+	}
+	return resp.Data, nil
+}
+
+// secretManager reads secret version from Google Cloud Secret Manager
+func (r *Resolver) secretManager(name string) (string, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	ts, err := google.DefaultTokenSource(ctx, secretManagerScope)
+	if err != nil {
+		return "", err
+	}
+	token, err := ts.Token()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(
+		http.MethodGet,
+		secretManagerUrl+name+":access",
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	token.SetAuthHeader(req)
+
+	data, err := r.do(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp secretManagerResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+
+	value, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// do sends request and returns response body, non-2xx status is an error
+func (r *Resolver) do(req *http.Request) ([]byte, error) {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+
+	return data, nil
+}
+
+// redact returns reference without vault key for error messages
+func redact(ref string) string {
+	path, _, _ := strings.Cut(ref, "#")
+	return path
+}
@@ -0,0 +1,195 @@
+package secret
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const vaultToken = "vault-test-token"
+
+// fakeVault is fake Vault server with KV v1 and KV v2 secrets
+type fakeVault struct {
+	mu         sync.Mutex
+	requests   int
+	namespaces []string
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests++
+	f.namespaces = append(f.namespaces, r.Header.Get("X-Vault-Namespace"))
+	f.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != vaultToken {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/kv/atlassian":
+		_, _ = w.Write([]byte(`{"data":{"token":"v1-token","port":8200}}`))
+	case "/v1/secret/data/atlassian":
+		_, _ = w.Write([]byte(`{"data":{
+			"data":{"token":"v2-token","account":"backup@example.com"},
+			"metadata":{"version":3}
+		}}`))
+	case "/v1/kv/nested":
+		// KV v1 secret with own "data" key isn't unwrapped
+		_, _ = w.Write([]byte(`{"data":{"data":{"token":"inner"},"token":"outer"}}`))
+	case "/v1/secret/data/broken":
+		http.Error(w, `{"errors":[]}`, http.StatusInternalServerError)
+	default:
+		http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+	}
+}
+
+func newVault(t *testing.T) *fakeVault {
+	t.Helper()
+
+	f := &fakeVault{}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	t.Setenv("VAULT_ADDR", srv.URL+"/")
+	t.Setenv("VAULT_TOKEN", vaultToken)
+	return f
+}
+
+func TestVault(t *testing.T) {
+	f := newVault(t)
+	r := NewResolver()
+
+	for ref, want := range map[string]string{
+		"vault://kv/atlassian#token":            "v1-token",
+		"vault://secret/data/atlassian#token":   "v2-token",
+		"vault://secret/data/atlassian#account": "backup@example.com",
+		"vault:///secret/data/atlassian#token":  "v2-token",
+		"vault://kv/nested#token":               "outer",
+	} {
+		got, err := r.Resolve(ref)
+		if err != nil {
+			t.Errorf("Resolve(%q) error: %v", ref, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", ref, got, want)
+		}
+	}
+
+	// Keys of the same secret are read by one request
+	if f.requests != 4 {
+		t.Errorf("Vault got %d requests, want 4", f.requests)
+	}
+}
+
+func TestVaultErrors(t *testing.T) {
+	newVault(t)
+
+	for ref, want := range map[string]string{
+		"vault://secret/data/atlassian#missing": "key missing is not found",
+		"vault://kv/atlassian#port":             "is not a string",
+		"vault://secret/data/unknown#token":     "404 Not Found",
+		"vault://secret/data/broken#token":      "500 Internal Server Error",
+		"vault://secret/data/atlassian":         "path#key format",
+	} {
+		_, err := NewResolver().Resolve(ref)
+		if err == nil {
+			t.Errorf("Resolve(%q): no error", ref)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Resolve(%q) error %q, want %q", ref, err, want)
+		}
+		if _, key, ok := strings.Cut(ref, "#"); ok && strings.Contains(err.Error(), "#"+key) {
+			t.Errorf("Resolve(%q) error %q contains key", ref, err)
+		}
+	}
+}
+
+func TestVaultForbidden(t *testing.T) {
+	newVault(t)
+	t.Setenv("VAULT_TOKEN", "wrong")
+
+	_, err := NewResolver().Resolve("vault://secret/data/atlassian#token")
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("error = %v, want 403 Forbidden", err)
+	}
+}
+
+func TestVaultNamespace(t *testing.T) {
+	f := newVault(t)
+
+	if _, err := NewResolver().Resolve("vault://kv/atlassian#token"); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	t.Setenv("VAULT_NAMESPACE", "team/backup")
+	if _, err := NewResolver().Resolve("vault://kv/atlassian#token"); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+
+	if want := []string{"", "team/backup"}; strings.Join(f.namespaces, ",") != strings.Join(want, ",") {
+		t.Errorf("namespaces = %q, want %q", f.namespaces, want)
+	}
+}
+
+func TestVaultNotConfigured(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	os.Unsetenv("VAULT_ADDR")
+
+	_, err := NewResolver().Resolve("vault://kv/atlassian#token")
+	if err == nil || !strings.Contains(err.Error(), "VAULT_ADDR is not set") {
+		t.Errorf("error = %v, want VAULT_ADDR is not set", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("file-token\r\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewResolver().Resolve("file://" + path)
+	if err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	if got != "file-token" {
+		t.Errorf("Resolve = %q, want file-token", got)
+	}
+
+	if _, err := NewResolver().Resolve("file://" + path + ".missing"); err == nil {
+		t.Error("Resolve of missing file: no error")
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("SECRET_TEST_TOKEN", "env-token")
+
+	got, err := NewResolver().Resolve("env://SECRET_TEST_TOKEN")
+	if err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	if got != "env-token" {
+		t.Errorf("Resolve = %q, want env-token", got)
+	}
+
+	_, err = NewResolver().Resolve("env://SECRET_TEST_UNSET")
+	if err == nil || !strings.Contains(err.Error(), "SECRET_TEST_UNSET is not set") {
+		t.Errorf("error = %v, want variable is not set", err)
+	}
+}
+
+func TestPlainValue(t *testing.T) {
+	got, err := NewResolver().Resolve("plain-token")
+	if err != nil || got != "plain-token" {
+		t.Errorf("Resolve = %q, %v, want value as is", got, err)
+	}
+	if IsReference("plain-token") || !IsReference("env://X") {
+		t.Error("IsReference is wrong")
+	}
+}
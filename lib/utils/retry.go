@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+A RetryPolicy presents retries of failed requests: exponential backoff with
+full jitter. Delay before attempt N is random value from zero to
+InitialDelay * 2^(N-1), but not more than MaxDelay. Retry-After response
+header overrides the delay, but it's limited by MaxDelay too
+*/
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// DefaultRetryPolicy is used, if retry settings are not configured
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: 2 * time.Second,
+	MaxDelay:     time.Minute,
+}
+
+/*
+A StatusError presents unsuccessful HTTP response. RetryAfter is a delay
+from Retry-After header, zero if header isn't set
+*/
+type StatusError struct {
+	Code       int
+	Status     string
+	Body       []byte
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Body) == 0 {
+		return "unexpected response " + e.Status
+	}
+	return fmt.Sprintf("unexpected response %s: %s", e.Status, e.Body)
+}
+
+/*
+Retryable reports whether failed request may succeed on retry: network
+errors, timeouts, 429 and 5xx responses. Authorization errors (401, 403),
+other client errors and context cancellation are fatal.
+
+Arguments:
+
+	err error
+
+Returns: bool
+*/
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code == http.StatusTooManyRequests ||
+			se.Code == http.StatusRequestTimeout ||
+			se.Code >= 500
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+/*
+Retry calls f until it succeeds, returns not retryable error, attempts are
+exhausted or context is done. Returns the last error
+
+Arguments:
+
+	ctx context.Context
+	p RetryPolicy
+	f func() error
+
+Returns: error
+*/
+func Retry(ctx context.Context, p RetryPolicy, f func() error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || !Retryable(err) || attempt >= attempts {
+			return err
+		}
+
+		delay := p.Delay(attempt)
+		var se *StatusError
+		if errors.As(err, &se) && se.RetryAfter > 0 {
+			delay = se.RetryAfter
+			if p.MaxDelay > 0 {
+				delay = min(delay, p.MaxDelay)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+/*
+Delay returns random backoff delay after failed attempt
+
+Arguments:
+
+	attempt int: failed attempt number, starting from 1
+
+Returns: time.Duration
+*/
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	max := p.InitialDelay
+	for i := 1; i < attempt && max < p.MaxDelay; i++ {
+		max *= 2
+	}
+	if p.MaxDelay > 0 && max > p.MaxDelay {
+		max = p.MaxDelay
+	}
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+/*
+retryAfter parses Retry-After header value: delay in seconds or HTTP date
+
+Arguments:
+
+	value string
+
+Returns: time.Duration
+*/
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(value); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
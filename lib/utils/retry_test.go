@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastPolicy retries without noticeable delays
+var fastPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: time.Millisecond,
+	MaxDelay:     5 * time.Millisecond,
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&StatusError{Code: http.StatusTooManyRequests}, true},
+		{&StatusError{Code: http.StatusRequestTimeout}, true},
+		{&StatusError{Code: http.StatusInternalServerError}, true},
+		{&StatusError{Code: http.StatusBadGateway}, true},
+		{&StatusError{Code: http.StatusServiceUnavailable}, true},
+		{&StatusError{Code: http.StatusGatewayTimeout}, true},
+		{Wrap("can't get backup progress", &StatusError{Code: http.StatusBadGateway}), true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{&StatusError{Code: http.StatusUnauthorized}, false},
+		{&StatusError{Code: http.StatusForbidden}, false},
+		{&StatusError{Code: http.StatusNotFound}, false},
+		{Wrap("can't run backup", &StatusError{Code: http.StatusForbidden}), false},
+		{context.Canceled, false},
+		{fmt.Errorf("run: %w", context.DeadlineExceeded), false},
+		{errors.New("unexpected progress"), false},
+		{nil, false},
+	} {
+		if got := Retryable(tc.err); got != tc.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryStopsOnFatalError(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), fastPolicy, func() error {
+		calls++
+		return &StatusError{Code: http.StatusUnauthorized, Status: "401 Unauthorized"}
+	})
+
+	if calls != 1 {
+		t.Errorf("f is called %d times, want 1", calls)
+	}
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusUnauthorized {
+		t.Errorf("error = %v, want 401", err)
+	}
+}
+
+func TestRetryExhaustsAttempts(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), fastPolicy, func() error {
+		calls++
+		return &StatusError{Code: http.StatusBadGateway, Status: "502 Bad Gateway"}
+	})
+
+	if calls != fastPolicy.MaxAttempts {
+		t.Errorf("f is called %d times, want %d", calls, fastPolicy.MaxAttempts)
+	}
+	if err == nil {
+		t.Error("no error after all attempts failed")
+	}
+}
+
+func TestRetryStopsOnContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 5, InitialDelay: time.Hour, MaxDelay: time.Hour}
+
+	calls := 0
+	err := Retry(ctx, policy, func() error {
+		calls++
+		cancel()
+		return &StatusError{Code: http.StatusServiceUnavailable}
+	})
+
+	if calls != 1 || err == nil {
+		t.Errorf("f is called %d times with error %v, want 1 call and error", calls, err)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	for name, header := range map[string]func() string{
+		"seconds": func() string { return "1" },
+		"date": func() string {
+			return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					w.Header().Set("Retry-After", header())
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				_, _ = w.Write([]byte("ok"))
+			}))
+			defer srv.Close()
+
+			// Backoff delay is too long for test, so only Retry-After delay
+			// lets the second attempt happen in time
+			policy := RetryPolicy{MaxAttempts: 2, InitialDelay: time.Hour, MaxDelay: time.Hour}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			started := time.Now()
+			data, err := Request(ctx, policy, http.MethodGet, serverUrl(t, srv), nil, nil)
+			took := time.Since(started)
+
+			if err != nil {
+				t.Fatalf("Request error: %v", err)
+			}
+			if string(data) != "ok" || calls.Load() != 2 {
+				t.Errorf("Request = %q after %d calls, want ok after 2", data, calls.Load())
+			}
+			if took < 900*time.Millisecond {
+				t.Errorf("retry is done after %s, Retry-After isn't honoured", took)
+			}
+		})
+	}
+}
+
+func TestRetryAfterIsLimited(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// An hour of Retry-After is limited by max delay
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	data, err := Request(ctx, fastPolicy, http.MethodGet, serverUrl(t, srv), nil, nil)
+	if err != nil {
+		t.Fatalf("Request error: %v", err)
+	}
+	if string(data) != "ok" || calls.Load() != 2 {
+		t.Errorf("Request = %q after %d calls, want ok after 2", data, calls.Load())
+	}
+}
+
+func TestRetryAfterParsing(t *testing.T) {
+	if d := retryAfter("30"); d != 30*time.Second {
+		t.Errorf("retryAfter(30) = %s", d)
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d := retryAfter(date); d < 58*time.Second || d > time.Minute {
+		t.Errorf("retryAfter(%s) = %s, want about 1m", date, d)
+	}
+
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	for _, v := range []string{"", "0", "-5", "soon", past} {
+		if d := retryAfter(v); d != 0 {
+			t.Errorf("retryAfter(%q) = %s, want 0", v, d)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts:  10,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+	}
+
+	for attempt := 1; attempt <= 20; attempt++ {
+		limit := p.InitialDelay << (attempt - 1)
+		if attempt > 5 || limit > p.MaxDelay {
+			limit = p.MaxDelay
+		}
+
+		for i := 0; i < 200; i++ {
+			if d := p.Delay(attempt); d < 0 || d > limit {
+				t.Fatalf("Delay(%d) = %s, want from 0 to %s", attempt, d, limit)
+			}
+		}
+	}
+
+	if d := (RetryPolicy{}).Delay(3); d != 0 {
+		t.Errorf("zero policy Delay = %s, want 0", d)
+	}
+}
+
+func TestRequestSucceedsAfterFailures(t *testing.T) {
+	failures := []int{
+		http.StatusBadGateway,
+		http.StatusTooManyRequests,
+		http.StatusServiceUnavailable,
+	}
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		if r.Header.Get("Authorization") != "Basic dGVzdDp0b2tlbg==" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if n <= len(failures) {
+			http.Error(w, "try later", failures[n-1])
+			return
+		}
+		_, _ = w.Write([]byte(`{"progress":100}`))
+	}))
+	defer srv.Close()
+
+	data, err := Request(
+		context.Background(),
+		fastPolicy,
+		http.MethodGet,
+		serverUrl(t, srv),
+		BasicAuth("test", "token"),
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("Request error: %v", err)
+	}
+	if string(data) != `{"progress":100}` {
+		t.Errorf("Request = %q", data)
+	}
+	if got, want := int(calls.Load()), len(failures)+1; got != want {
+		t.Errorf("server got %d requests, want %d", got, want)
+	}
+}
+
+func TestRequestFailsOnUnauthorized(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "Client must be authenticated", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := Request(context.Background(), fastPolicy, http.MethodGet, serverUrl(t, srv), nil, nil)
+
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusUnauthorized {
+		t.Errorf("error = %v, want 401", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server got %d requests, want 1", calls.Load())
+	}
+}
+
+func serverUrl(t *testing.T, srv *httptest.Server) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(srv.URL + "/rest/backup/1/export/getProgress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestRequestLimitsErrorBody(t *testing.T) {
+	page := strings.Repeat("<p>Service is unavailable</p>", 100000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	policy := RetryPolicy{MaxAttempts: 1}
+	_, err := Request(context.Background(), policy, http.MethodGet, serverUrl(t, srv), nil, nil)
+
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable {
+		t.Fatalf("error = %v, want 503", err)
+	}
+	if len(se.Body) != maxErrorBody || !strings.HasPrefix(page, string(se.Body)) {
+		t.Errorf("error body has %d bytes, want the first %d", len(se.Body), maxErrorBody)
+	}
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+A TimeoutError presents pipeline phase, which exceeded its timeout. It's
+cause of cancelled phase context, so it isn't context.Canceled and timed out
+run isn't treated as interrupted one
+*/
+type TimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out in %s phase after %s", e.Phase, e.Timeout)
+}
+
+/*
+WithTimeout returns context, which is cancelled with *TimeoutError cause
+after timeout. Zero timeout means no timeout
+
+Arguments:
+
+	ctx context.Context
+	phase string: phase name for error message
+	timeout time.Duration
+
+Returns:
+
+	context.Context
+	context.CancelFunc
+*/
+func WithTimeout(
+	ctx context.Context,
+	phase string,
+	timeout time.Duration,
+) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, &TimeoutError{
+		Phase:   phase,
+		Timeout: timeout,
+	})
+}
+
+/*
+TimeoutCause returns *TimeoutError, if context is cancelled by phase
+timeout, otherwise err
+
+Arguments:
+
+	ctx context.Context
+	err error
+
+Returns: error
+*/
+func TimeoutCause(ctx context.Context, err error) error {
+	var te *TimeoutError
+	if err != nil && ctx.Err() != nil && errors.As(context.Cause(ctx), &te) {
+		return te
+	}
+	return err
+}
+
+/*
+A PhaseTimer limits consecutive phases of one operation, which share single
+context, e.g. download and upload of streamed file. Context is cancelled
+with *TimeoutError cause, if current phase exceeds its timeout
+*/
+type PhaseTimer struct {
+	mu     sync.Mutex
+	cancel context.CancelCauseFunc
+	timer  *time.Timer
+}
+
+/*
+NewPhaseTimer returns context, which is cancelled by phase timeouts, and
+timer. Stop must be called, when operation is finished
+
+Arguments:
+
+	ctx context.Context
+
+Returns:
+
+	context.Context
+	*PhaseTimer
+*/
+func NewPhaseTimer(ctx context.Context) (context.Context, *PhaseTimer) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return ctx, &PhaseTimer{cancel: cancel}
+}
+
+/*
+Start starts phase timeout instead of previous phase one. Zero timeout means
+no timeout
+
+Arguments:
+
+	phase string
+	timeout time.Duration
+*/
+func (t *PhaseTimer) Start(phase string, timeout time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	err := &TimeoutError{Phase: phase, Timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() { t.cancel(err) })
+}
+
+// Stop stops phase timeout and releases context
+func (t *PhaseTimer) Stop() {
+	t.Start("", 0)
+	t.cancel(nil)
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitDone waits for context cancellation and fails test on timeout
+func waitDone(t *testing.T, ctx context.Context) {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context isn't cancelled")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), "generation", 10*time.Millisecond)
+	defer cancel()
+	waitDone(t, ctx)
+
+	var te *TimeoutError
+	if !errors.As(context.Cause(ctx), &te) {
+		t.Fatalf("context cause = %v, want *TimeoutError", context.Cause(ctx))
+	}
+	if te.Phase != "generation" || te.Timeout != 10*time.Millisecond {
+		t.Errorf("TimeoutError = %+v", te)
+	}
+	if got, want := te.Error(), "timed out in generation phase after 10ms"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	// Timed out context isn't cancelled one
+	if errors.Is(context.Cause(ctx), context.Canceled) {
+		t.Error("context cause is context.Canceled")
+	}
+}
+
+func TestWithZeroTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), "run", 0)
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("zero timeout sets deadline")
+	}
+
+	cancel()
+	if !errors.Is(context.Cause(ctx), context.Canceled) {
+		t.Errorf("context cause = %v, want context.Canceled", context.Cause(ctx))
+	}
+}
+
+func TestTimeoutCause(t *testing.T) {
+	failed := errors.New("can't get backup progress")
+
+	timedOut, cancel := WithTimeout(context.Background(), "download", time.Millisecond)
+	defer cancel()
+	waitDone(t, timedOut)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{"timed out", timedOut, context.DeadlineExceeded, "timed out in download phase after 1ms"},
+		{"timed out without error", timedOut, nil, ""},
+		{"cancelled", cancelled, failed, failed.Error()},
+		{"running", context.Background(), failed, failed.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := TimeoutCause(tc.ctx, tc.err)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tc.want {
+				t.Errorf("TimeoutCause() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPhaseTimer(t *testing.T) {
+	ctx, timer := NewPhaseTimer(context.Background())
+	defer timer.Stop()
+
+	// The next phase replaces timeout of the previous one
+	timer.Start("download", 10*time.Millisecond)
+	timer.Start("upload", time.Hour)
+	time.Sleep(30 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("context is cancelled by previous phase timeout: %v", context.Cause(ctx))
+	}
+
+	timer.Start("upload", 10*time.Millisecond)
+	waitDone(t, ctx)
+
+	var te *TimeoutError
+	if !errors.As(context.Cause(ctx), &te) || te.Phase != "upload" {
+		t.Errorf("context cause = %v, want upload *TimeoutError", context.Cause(ctx))
+	}
+}
+
+func TestPhaseTimerStop(t *testing.T) {
+	ctx, timer := NewPhaseTimer(context.Background())
+	timer.Start("download", 10*time.Millisecond)
+	timer.Stop()
+
+	if !errors.Is(context.Cause(ctx), context.Canceled) {
+		t.Errorf("context cause = %v, want context.Canceled", context.Cause(ctx))
+	}
+
+	// Stopped phase timeout doesn't replace cause
+	time.Sleep(30 * time.Millisecond)
+	if !errors.Is(context.Cause(ctx), context.Canceled) {
+		t.Errorf("context cause = %v after phase timeout", context.Cause(ctx))
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the application tracer name, see package tracing
+const tracerName = "atlassian_backup"
+
+// startSpan starts client span of web request
+func startSpan(
+	ctx context.Context,
+	method string,
+	u *url.URL,
+) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(
+		ctx,
+		"HTTP "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("server.address", u.Host),
+			attribute.String("url.path", u.Path),
+		),
+	)
+}
+
+// endSpan records request attempts count and result and ends span
+func endSpan(span trace.Span, attempts int, err error) {
+	span.SetAttributes(attribute.Int("http.attempts", attempts))
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		span.SetAttributes(attribute.Int("http.response.status_code", se.Code))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -2,10 +2,14 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -18,14 +22,26 @@ func Timestamp() string {
 	return time.Now().Format("2006_01_02_15_04")
 }
 
+const (
+	// requestTimeout limits single API request attempt
+	requestTimeout = 2 * time.Minute
+	// maxErrorBody limits error response body in errors
+	maxErrorBody = 4096
+)
+
 /*
 Request do web request, returns data, as an array bytes or error if
-request fail
+request fail. Failed request is retried by policy, if error is retryable
+(see Retryable). Unsuccessful response is returned as *StatusError. Request
+is traced as client span with all attempts
 
 Arguments:
 
+	ctx context.Context: request is cancelled, when context is done
+	policy RetryPolicy
 	method string
 	url *url.URL
+	header http.Header: additional request headers, e.g. authorization
 	reqData io.Reader
 
 Returns:
@@ -34,35 +50,147 @@ Returns:
 	err error
 */
 func Request(
+	ctx context.Context,
+	policy RetryPolicy,
 	method string,
 	url *url.URL,
+	header http.Header,
 	reqData io.Reader,
 ) (data []byte, err error) {
 	defer func() { err = WrapIfErr("can't do request", err) }()
 
-	c := http.Client{
-		Timeout: 0,
+	var body []byte
+	if reqData != nil {
+		body, err = io.ReadAll(reqData)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	req, err := http.NewRequest(method, url.String(), reqData)
+	ctx, span := startSpan(ctx, method, url)
+	attempts := 0
+	defer func() { endSpan(span, attempts, err) }()
+
+	err = Retry(ctx, policy, func() error {
+		attempts++
+		data, _, err = request(ctx, method, url, header, body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+/*
+Head do HEAD web request, returns response headers or error if request fail.
+Failed request is retried by policy like in Request
+
+Arguments:
+
+	ctx context.Context
+	policy RetryPolicy
+	url *url.URL
+	header http.Header: additional request headers, e.g. authorization
+
+Returns:
+
+	respHeader http.Header
+	err error
+*/
+func Head(
+	ctx context.Context,
+	policy RetryPolicy,
+	url *url.URL,
+	header http.Header,
+) (respHeader http.Header, err error) {
+	defer func() { err = WrapIfErr("can't do request", err) }()
+
+	ctx, span := startSpan(ctx, http.MethodHead, url)
+	attempts := 0
+	defer func() { endSpan(span, attempts, err) }()
+
+	err = Retry(ctx, policy, func() error {
+		attempts++
+		_, respHeader, err = request(ctx, http.MethodHead, url, header, nil)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+
+	return respHeader, nil
+}
+
+// request do single web request attempt
+func request(
+	ctx context.Context,
+	method string,
+	url *url.URL,
+	header http.Header,
+	body []byte,
+) ([]byte, http.Header, error) {
+	c := http.Client{
+		Timeout: requestTimeout,
+	}
+
+	var reqData io.Reader
+	if body != nil {
+		reqData = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url.String(), reqData)
+	if err != nil {
+		return nil, nil, err
+	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
 
 	resp, err := c.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	data, err = io.ReadAll(resp.Body)
+	// Error page may be large, only its beginning is kept in error
+	if err := CheckResponse(resp); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return data, nil
+	return data, resp.Header, nil
+}
+
+/*
+CheckResponse returns *StatusError with the beginning of response body, if
+response is unsuccessful, e.g. Atlassian error page instead of backup file
+
+Arguments:
+
+	resp *http.Response
+
+Returns: error
+*/
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &StatusError{
+		Code:       resp.StatusCode,
+		Status:     resp.Status,
+		Body:       bytes.TrimSpace(data),
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
 }
 
 /*
@@ -85,9 +213,9 @@ func NiceSize(b int64) string {
 	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
-// Wrap returns formatted error message
+// Wrap returns formatted error message, credentials are redacted from it
 func Wrap(msg string, err error) error {
-	return fmt.Errorf("%s: %w", msg, err)
+	return &redactedError{msg: msg, err: err}
 }
 
 // WrapIfErr returns formatted error message if error is
@@ -98,3 +226,39 @@ func WrapIfErr(msg string, err error) error {
 
 	return Wrap(msg, err)
 }
+
+/*
+WriteFileAtomic writes data to temporary file and renames it to path, so
+readers never see partially written file. Parent folders are created if
+they don't exist
+
+Arguments:
+
+	path string
+	data []byte
+
+Returns: error
+*/
+func WriteFileAtomic(path string, data []byte) (err error) {
+	defer func() { err = WrapIfErr("can't write file "+path, err) }()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
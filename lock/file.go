@@ -0,0 +1,229 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+/*
+A File is lock Backend, which keeps lock record in local file locked by
+flock. Lock is held by open file descriptor, so kernel releases it, when
+holder process dies, and stale lock is never removed by another process.
+Generation is counted by holder, so it doesn't depend on file timestamps
+*/
+type File struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	gen  int64
+}
+
+/*
+NewFile returns new File lock backend
+
+Arguments:
+
+	path string: lock file path
+
+Returns: *File
+*/
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Create locks lock file and writes record to it, if it isn't locked
+func (f *File) Create(_ context.Context, data []byte) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		return 0, ErrLocked
+	}
+
+	file, err := f.flock()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := write(file, data); err != nil {
+		_ = os.Remove(f.path)
+		_ = file.Close()
+		return 0, err
+	}
+
+	f.file = file
+	f.gen++
+	return f.gen, nil
+}
+
+// Read returns lock file content
+func (f *File) Read(_ context.Context) ([]byte, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrNotExist
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return data, f.gen, nil
+}
+
+// Replace rewrites lock record, if lock is held with generation gen
+func (f *File) Replace(_ context.Context, data []byte, gen int64) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.held(gen); err != nil {
+		return 0, err
+	}
+
+	if err := write(f.file, data); err != nil {
+		return 0, err
+	}
+
+	f.gen++
+	return f.gen, nil
+}
+
+/*
+Delete removes lock file and releases lock, if it's held with generation
+gen. Lock, which is held by another process, can't be deleted, ErrLocked is
+returned
+*/
+func (f *File) Delete(_ context.Context, gen int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		// Lock of another process is released by kernel only
+		file, err := f.flock()
+		if err != nil {
+			return err
+		}
+		return file.Close()
+	}
+
+	err := f.held(gen)
+	if errors.Is(err, ErrLocked) {
+		return err
+	}
+	if err == nil {
+		// File is removed before unlock, so process, which opened it,
+		// finds it's removed after lock
+		err = os.Remove(f.path)
+	}
+	_ = f.file.Close()
+	f.file = nil
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
+
+/*
+flock opens and locks lock file. Returns ErrLocked, if file is locked by
+another process. Lock file may be removed by holder between open and lock,
+so lock is retried on the new file then
+
+Returns:
+
+	*os.File
+	error
+*/
+func (f *File) flock() (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return nil, err
+	}
+
+	for {
+		file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			_ = file.Close()
+			return nil, ErrLocked
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+
+		same, err := f.current(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		if same {
+			return file, nil
+		}
+		_ = file.Close()
+	}
+}
+
+/*
+held returns ErrLocked, if lock isn't held by this backend with generation
+gen, and ErrNotExist, if locked file is removed meanwhile
+
+Arguments:
+
+	gen int64
+
+Returns: error
+*/
+func (f *File) held(gen int64) error {
+	if f.file == nil || f.gen != gen {
+		return ErrLocked
+	}
+
+	same, err := f.current(f.file)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return ErrNotExist
+	}
+	return nil
+}
+
+// current reports whether open file is the file at lock path
+func (f *File) current(file *os.File) (bool, error) {
+	opened, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return os.SameFile(opened, info), nil
+}
+
+// write replaces file content with data
+func write(file *os.File, data []byte) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
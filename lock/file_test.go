@@ -0,0 +1,221 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func lockPath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "locks", "example_jira.lock")
+}
+
+func TestFileExclusive(t *testing.T) {
+	ctx := context.Background()
+	path := lockPath(t)
+
+	l, _, err := Acquire(ctx, NewFile(path), "example-jira", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire error: %v", err)
+	}
+
+	_, _, err = Acquire(ctx, NewFile(path), "example-jira", time.Minute)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Acquire error = %v, want ErrLocked", err)
+	}
+
+	if err := l.Release(ctx); err != nil {
+		t.Fatalf("Release error: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file isn't removed: %v", err)
+	}
+
+	l, _, err = Acquire(ctx, NewFile(path), "example-jira", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire after Release error: %v", err)
+	}
+	_ = l.Release(ctx)
+}
+
+func TestFileExpiredRecordOfLiveHolder(t *testing.T) {
+	ctx := context.Background()
+	path := lockPath(t)
+
+	// Holder is alive, but its record is expired, e.g. it hangs
+	holder := NewFile(path)
+	if _, err := holder.Create(ctx, []byte(`{"expires":"2000-01-01T00:00:00Z"}`)); err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+
+	_, _, err := Acquire(ctx, NewFile(path), "example-jira", time.Minute)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Acquire error = %v, want ErrLocked", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("lock file of live holder is removed: %v", err)
+	}
+}
+
+func TestFileReleasedByClosedDescriptor(t *testing.T) {
+	ctx := context.Background()
+	path := lockPath(t)
+
+	holder := NewFile(path)
+	if _, err := holder.Create(ctx, []byte(`{}`)); err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	// Crashed holder leaves lock file, but its descriptor is closed
+	_ = holder.file.Close()
+
+	l, _, err := Acquire(ctx, NewFile(path), "example-jira", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire error: %v", err)
+	}
+	_ = l.Release(ctx)
+}
+
+func TestFileGeneration(t *testing.T) {
+	ctx := context.Background()
+	f := NewFile(lockPath(t))
+
+	gen, err := f.Create(ctx, []byte("first"))
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+
+	newGen, err := f.Replace(ctx, []byte("second"), gen)
+	if err != nil {
+		t.Fatalf("Replace error: %v", err)
+	}
+	if newGen == gen {
+		t.Error("Replace doesn't change generation")
+	}
+
+	data, _, err := f.Read(ctx)
+	if err != nil || string(data) != "second" {
+		t.Errorf("Read = %q, %v, want second", data, err)
+	}
+
+	if _, err := f.Replace(ctx, []byte("third"), gen); !errors.Is(err, ErrLocked) {
+		t.Errorf("Replace with old generation error = %v, want ErrLocked", err)
+	}
+	if err := f.Delete(ctx, gen); !errors.Is(err, ErrLocked) {
+		t.Errorf("Delete with old generation error = %v, want ErrLocked", err)
+	}
+	if err := f.Delete(ctx, newGen); err != nil {
+		t.Errorf("Delete error: %v", err)
+	}
+}
+
+func TestFileRemovedLockIsLost(t *testing.T) {
+	ctx := context.Background()
+	path := lockPath(t)
+	f := NewFile(path)
+
+	gen, err := f.Create(ctx, []byte("first"))
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Replace(ctx, []byte("second"), gen); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Replace of removed lock error = %v, want ErrNotExist", err)
+	}
+	if err := f.Delete(ctx, gen); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Delete of removed lock error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestFileConcurrentAcquire(t *testing.T) {
+	ctx := context.Background()
+	path := lockPath(t)
+
+	for round := 0; round < 20; round++ {
+		var (
+			wg      sync.WaitGroup
+			holders atomic.Int32
+			locks   = make(chan *Lock, 8)
+		)
+		for i := 0; i < cap(locks); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l, _, err := Acquire(ctx, NewFile(path), "example-jira", time.Minute)
+				if err != nil {
+					if !errors.Is(err, ErrLocked) {
+						t.Errorf("Acquire error: %v", err)
+					}
+					return
+				}
+				holders.Add(1)
+				locks <- l
+			}()
+		}
+		wg.Wait()
+		close(locks)
+
+		if n := holders.Load(); n != 1 {
+			t.Fatalf("round %d: %d holders, want 1", round, n)
+		}
+		for l := range locks {
+			_ = l.Release(ctx)
+		}
+	}
+}
+
+// TestFileHolderProcess holds lock in helper process until it's killed
+func TestFileHolderProcess(t *testing.T) {
+	path := os.Getenv("LOCK_TEST_HOLD")
+	if path == "" {
+		t.Skip("helper process only")
+	}
+
+	if _, _, err := Acquire(context.Background(), NewFile(path), "holder", time.Minute); err != nil {
+		t.Fatalf("Acquire error: %v", err)
+	}
+	os.Stdout.WriteString("locked\n")
+	time.Sleep(time.Minute)
+}
+
+func TestFileReleasedOnHolderDeath(t *testing.T) {
+	ctx := context.Background()
+	path := lockPath(t)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFileHolderProcess$")
+	cmd.Env = append(os.Environ(), "LOCK_TEST_HOLD="+path)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+
+	if line, err := bufio.NewReader(out).ReadString('\n'); err != nil || line != "locked\n" {
+		t.Fatalf("helper process output %q, %v", line, err)
+	}
+
+	if _, _, err := Acquire(ctx, NewFile(path), "example-jira", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Acquire while holder runs error = %v, want ErrLocked", err)
+	}
+
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+
+	l, _, err := Acquire(ctx, NewFile(path), "example-jira", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire after holder death error: %v", err)
+	}
+	_ = l.Release(ctx)
+}
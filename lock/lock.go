@@ -0,0 +1,229 @@
+/*
+Package lock implements run lock, which prevents concurrent runs of backup
+of the same workspace and product by several application instances.
+
+Lock is a record with holder and expiration time, which is created only if
+it doesn't exist. Holder refreshes the record, while it runs. Lock of
+crashed holder isn't refreshed, so it becomes stale after TTL and is taken
+over by the next run. Record is stored by Backend: local file or object in
+Google Storage bucket, which is shared by instances on different hosts.
+Local file is locked by flock, so it's released by kernel, when holder
+dies, and it's never taken over from running process.
+*/
+package lock
+
+import (
+	"atlassian_backup/lib/utils"
+	"atlassian_backup/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrLocked is returned, if lock is held by another process
+var ErrLocked = errors.New("lock is held by another process")
+
+// ErrNotExist is returned by Backend, if lock record doesn't exist
+var ErrNotExist = errors.New("lock doesn't exist")
+
+/*
+A Backend presents lock record storage. Every change of record gets new
+generation, changes with generation are applied only if record generation
+matches. Create and conditional changes return ErrLocked, if condition
+fails
+
+Methods:
+
+	Create(ctx context.Context, data []byte) (gen int64, err error)
+	Read(ctx context.Context) (data []byte, gen int64, err error)
+	Replace(ctx context.Context, data []byte, gen int64) (newGen int64, err error)
+	Delete(ctx context.Context, gen int64) (err error)
+*/
+type Backend interface {
+	Create(ctx context.Context, data []byte) (gen int64, err error)
+	Read(ctx context.Context) (data []byte, gen int64, err error)
+	Replace(ctx context.Context, data []byte, gen int64) (newGen int64, err error)
+	Delete(ctx context.Context, gen int64) (err error)
+}
+
+// A record presents lock holder
+type record struct {
+	Holder  string    `json:"holder"`
+	Job     string    `json:"job"`
+	Expires time.Time `json:"expires"`
+}
+
+// A Lock presents acquired lock
+type Lock struct {
+	backend Backend
+	ttl     time.Duration
+	job     string
+
+	gen    int64
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+/*
+Acquire takes lock or returns ErrLocked, if it's held by another process and
+isn't stale. Lock is refreshed in background until Release. Returned context
+is cancelled, if lock is lost, e.g. it wasn't refreshed in time
+
+Arguments:
+
+	ctx context.Context
+	b Backend
+	job string: job name for lock holder description
+	ttl time.Duration: lock lifetime without refresh
+
+Returns:
+
+	*Lock
+	context.Context
+	error
+*/
+func Acquire(
+	ctx context.Context,
+	b Backend,
+	job string,
+	ttl time.Duration,
+) (l *Lock, lockCtx context.Context, err error) {
+	defer func() { err = utils.WrapIfErr("can't acquire run lock", err) }()
+
+	l = &Lock{
+		backend: b,
+		ttl:     ttl,
+		job:     job,
+		done:    make(chan struct{}),
+	}
+
+	data, err := l.record()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The second attempt is made after stale lock removal
+	for attempt := 0; ; attempt++ {
+		l.gen, err = b.Create(ctx, data)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLocked) || attempt > 0 {
+			return nil, nil, err
+		}
+
+		held, gen, err := b.Read(ctx)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var r record
+		if err := json.Unmarshal(held, &r); err == nil && time.Now().Before(r.Expires) {
+			return nil, nil, fmt.Errorf(
+				"%w: %s runs %s until %s",
+				ErrLocked,
+				r.Holder,
+				r.Job,
+				r.Expires.Format(time.RFC3339),
+			)
+		}
+
+		// Stale or broken lock is removed, only if it's not refreshed meanwhile
+		if err := b.Delete(ctx, gen); err != nil && !errors.Is(err, ErrNotExist) {
+			return nil, nil, err
+		}
+	}
+
+	lockCtx, l.cancel = context.WithCancel(ctx)
+	go l.refresh(lockCtx)
+
+	return l, lockCtx, nil
+}
+
+/*
+Release stops lock refresh and removes lock. Returns error if failure
+
+Arguments:
+
+	ctx context.Context
+
+Returns: error
+*/
+func (l *Lock) Release(ctx context.Context) (err error) {
+	defer func() { err = utils.WrapIfErr("can't release run lock", err) }()
+
+	// Refresh is stopped before removal, so generation isn't changed
+	l.cancel()
+	<-l.done
+
+	err = l.backend.Delete(ctx, l.gen)
+	if errors.Is(err, ErrNotExist) || errors.Is(err, ErrLocked) {
+		// Lock is already taken over by another process
+		return nil
+	}
+	return err
+}
+
+/*
+refresh extends lock expiration every third of TTL until context is done.
+Context is cancelled, if lock is taken over or expires
+
+Arguments:
+
+	ctx context.Context
+*/
+func (l *Lock) refresh(ctx context.Context) {
+	defer close(l.done)
+
+	expires := time.Now().Add(l.ttl)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := l.record()
+		if err == nil {
+			var gen int64
+			gen, err = l.backend.Replace(ctx, data, l.gen)
+			if err == nil {
+				l.gen = gen
+				expires = time.Now().Add(l.ttl)
+			}
+		}
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+
+		if errors.Is(err, ErrLocked) || errors.Is(err, ErrNotExist) ||
+			time.Now().After(expires) {
+			logger.Errorf("Run lock of %s is lost, run is cancelled: %v\n", l.job, err)
+			l.cancel()
+			return
+		}
+	}
+}
+
+// record returns lock record with new expiration time
+func (l *Lock) record() ([]byte, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return json.Marshal(record{
+		Holder:  fmt.Sprintf("%s (pid %d)", host, os.Getpid()),
+		Job:     l.job,
+		Expires: time.Now().Add(l.ttl),
+	})
+}
@@ -1,48 +1,172 @@
-// Package logger implements an application log settings
+/*
+Package logger implements an application leveled structured logger.
+
+Log lines are written to stdout in one of formats, which is selected by
+LOG_FORMAT environment variable:
+
+	text: human-readable lines, level is colored on terminal (default)
+	logfmt: key=value pairs
+	json: JSON objects
+
+LOG_LEVEL environment variable sets the lowest written level: debug, info
+(default), warning or error.
+
+Loggers created by With add fields to every line, e.g. run ID, workspace
+and backup type, so log pipelines can filter lines by them.
+*/
 package logger
 
 import (
+	"atlassian_backup/lib/utils"
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
 )
 
+// A Logger writes leveled log lines with fields
+type Logger struct {
+	l *slog.Logger
+}
+
 var (
-	Error   *log.Logger
-	Info    *log.Logger
-	Warning *log.Logger
+	initOnce sync.Once
+	std      *Logger
 )
 
-type Color string
+// root returns application logger, which is created on the first use
+func root() *Logger {
+	initOnce.Do(func() {
+		std = New(os.Stdout, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"))
+	})
+	return std
+}
 
-const (
-	ColorRed    Color = "\u001b[31m"
-	ColorGreen  Color = "\u001b[32m"
-	ColorYellow Color = "\u001b[33m"
-	ColorBlue   Color = "\u001b[34m"
-	ColorReset  Color = "\u001b[0m"
-)
+/*
+New returns new Logger, which writes lines to w. Unknown format means text,
+unknown level means info
+
+Arguments:
+
+	w io.Writer
+	format string: text, logfmt or json
+	level string: debug, info, warning or error
+
+Returns: *Logger
+*/
+func New(w io.Writer, format, level string) *Logger {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "logfmt":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		h = newTextHandler(w, opts.Level.Level(), isTerminal(w))
+	}
+
+	return &Logger{l: slog.New(h)}
+}
+
+/*
+With returns logger, which adds fields to every line
+
+Arguments:
+
+	args ...any: key-value pairs, e.g. "workspace", "acme"
+
+Returns: *Logger
+*/
+func With(args ...any) *Logger {
+	return root().With(args...)
+}
+
+// With returns logger, which adds fields to every line
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l: l.l.With(args...)}
+}
+
+// Debugf writes debug line
+func (l *Logger) Debugf(format string, args ...any) {
+	l.log(slog.LevelDebug, format, args...)
+}
+
+// Infof writes info line
+func (l *Logger) Infof(format string, args ...any) {
+	l.log(slog.LevelInfo, format, args...)
+}
+
+// Warningf writes warning line
+func (l *Logger) Warningf(format string, args ...any) {
+	l.log(slog.LevelWarn, format, args...)
+}
+
+// Errorf writes error line
+func (l *Logger) Errorf(format string, args ...any) {
+	l.log(slog.LevelError, format, args...)
+}
+
+// Fatalf writes error line and closes program with error code
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.log(slog.LevelError, format, args...)
+	os.Exit(1)
+}
+
+// Debugf writes debug line by application logger
+func Debugf(format string, args ...any) { root().Debugf(format, args...) }
+
+// Infof writes info line by application logger
+func Infof(format string, args ...any) { root().Infof(format, args...) }
+
+// Warningf writes warning line by application logger
+func Warningf(format string, args ...any) { root().Warningf(format, args...) }
+
+// Errorf writes error line by application logger
+func Errorf(format string, args ...any) { root().Errorf(format, args...) }
+
+// Fatalf writes error line by application logger and closes program
+func Fatalf(format string, args ...any) { root().Fatalf(format, args...) }
+
+// log formats message without trailing new line, redacts and writes it
+func (l *Logger) log(level slog.Level, format string, args ...any) {
+	ctx := context.Background()
+	if !l.l.Enabled(ctx, level) {
+		return
+	}
+
+	msg := utils.Redact(strings.TrimRight(fmt.Sprintf(format, args...), "\n"))
+	l.l.Log(ctx, level, msg)
+}
+
+// parseLevel converts level name to slog level, info is default
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warning", "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// isTerminal reports whether w is terminal, so colors can be used
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
 
-// Init setup application logger settings
-func Init() {
-	Error = log.New(
-		os.Stdout,
-		colorize(ColorRed, "ERROR: "),
-		log.Ldate|log.Ltime,
-	)
-	Info = log.New(
-		os.Stdout,
-		colorize(ColorBlue, "INFO: "),
-		log.Ldate|log.Ltime,
-	)
-	Warning = log.New(
-		os.Stdout,
-		colorize(ColorYellow, "WARNING: "),
-		log.Ldate|log.Ltime,
-	)
-}
-
-// colorize return string with selected color
-func colorize(color Color, message string) string {
-	return fmt.Sprintf("%s %s %s", string(color), message, string(ColorReset))
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
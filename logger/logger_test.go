@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"atlassian_backup/lib/utils"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogIsRedacted(t *testing.T) {
+	const token = "ATATT3xFfGF0-logger-token"
+	utils.AddSecret(token)
+
+	err := utils.Wrap("can't run backup", errors.New("token "+token+" is rejected"))
+
+	for _, format := range []string{"text", "logfmt", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, format, "debug").With("workspace", "example")
+
+			l.Errorf("Jira backup failure: %v\n", err)
+			l.Infof("Downloading https://backup:%s@example.atlassian.net/file\n", "s3cr3t")
+
+			out := buf.String()
+			for _, secret := range []string{token, "s3cr3t"} {
+				if strings.Contains(out, secret) {
+					t.Errorf("log contains %q:\n%s", secret, out)
+				}
+			}
+			if strings.Count(out, "***") != 2 {
+				t.Errorf("log has no redacted values:\n%s", out)
+			}
+		})
+	}
+}
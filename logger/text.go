@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type color string
+
+const (
+	colorRed    color = "\u001b[31m"
+	colorYellow color = "\u001b[33m"
+	colorBlue   color = "\u001b[34m"
+	colorGray   color = "\u001b[90m"
+	colorReset  color = "\u001b[0m"
+)
+
+/*
+A textHandler writes human-readable lines: time, level, message and fields
+as key=value pairs. Level is colored, if output is terminal
+*/
+type textHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Level
+	colors bool
+	// attrs are preformatted fields of the logger
+	attrs  string
+	prefix string
+}
+
+func newTextHandler(w io.Writer, level slog.Level, colors bool) *textHandler {
+	return &textHandler{
+		mu:     &sync.Mutex{},
+		w:      w,
+		level:  level,
+		colors: colors,
+	}
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(r.Time.Format("2006/01/02 15:04:05"))
+	buf.WriteByte(' ')
+	buf.WriteString(h.levelName(r.Level))
+	buf.WriteByte(' ')
+	buf.WriteString(r.Message)
+	buf.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(&buf, h.prefix, a)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var buf bytes.Buffer
+	for _, a := range attrs {
+		h.appendAttr(&buf, h.prefix, a)
+	}
+
+	c := *h
+	c.attrs += buf.String()
+	return &c
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.prefix += name + "."
+	return &c
+}
+
+// levelName returns fixed width level name, colored if colors are enabled
+func (h *textHandler) levelName(level slog.Level) string {
+	name, c := "INFO ", colorBlue
+	switch {
+	case level >= slog.LevelError:
+		name, c = "ERROR", colorRed
+	case level >= slog.LevelWarn:
+		name, c = "WARN ", colorYellow
+	case level < slog.LevelInfo:
+		name, c = "DEBUG", colorGray
+	}
+
+	if !h.colors {
+		return name
+	}
+	return string(c) + name + string(colorReset)
+}
+
+// appendAttr writes field as key=value, value is quoted if needed
+func (h *textHandler) appendAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			h.appendAttr(buf, prefix+a.Key+".", ga)
+		}
+		return
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(prefix + a.Key)
+	buf.WriteByte('=')
+
+	value := a.Value.String()
+	if needsQuote(value) {
+		value = strconv.Quote(value)
+	}
+	buf.WriteString(value)
+}
+
+// needsQuote reports whether field value has spaces or special characters
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	return strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r)
+	}) >= 0
+}
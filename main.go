@@ -1,10 +1,381 @@
 package main
 
-import "atlassian_backup/processor"
+import (
+	"atlassian_backup/api"
+	"atlassian_backup/config"
+	"atlassian_backup/history"
+	"atlassian_backup/lib/utils"
+	"atlassian_backup/logger"
+	"atlassian_backup/metrics"
+	"atlassian_backup/processor"
+	"atlassian_backup/runstate"
+	"atlassian_backup/scheduler"
+	"atlassian_backup/tracing"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `Usage: atlassian_backup [command] [flags]
+
+Commands:
+
+	run		run cloud backup and save it to storage (default)
+	download	save the latest completed cloud backup to storage
+	check		notify if the latest saved backup is overdue
+	daemon		run backups by jobs schedules
+	status		print state of the last run of every job
+	history		print finished runs, flags: -job, -outcome, -since,
+			-limit, -format (table or json)
+	config validate	check configuration and list all problems
+`
 
 func main() {
-	processor := processor.New()
+	// SIGINT and SIGTERM cancel running backups, so they are cleaned up
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
+	)
+	defer stop()
+
+	if err := tracing.Init(ctx); err != nil {
+		logger.Warningf("%v\n", err)
+	}
+	defer flush()
+
+	switch command() {
+	case "run":
+		c := config.MustLoad()
+		exit(summarize(c, forEachJob(ctx, c, func(ctx context.Context, job *config.Job) error {
+			defer push(c, job)
+			return processor.New(job, c.DataDir).Process(ctx)
+		})))
+	case "download":
+		c := config.MustLoad()
+		exit(summarize(c, forEachJob(ctx, c, func(ctx context.Context, job *config.Job) error {
+			defer push(c, job)
+			return processor.New(job, c.DataDir).Download(ctx)
+		})))
+	case "check":
+		c := config.MustLoad()
+		exit(failures(forEachJob(ctx, c, func(ctx context.Context, job *config.Job) error {
+			return processor.New(job, c.DataDir).Check(ctx)
+		})))
+	case "daemon":
+		daemon(ctx)
+	case "status":
+		status()
+	case "history":
+		printHistory()
+	case "config validate":
+		validate()
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+/*
+command removes command words from program arguments, so flags can be parsed,
+and returns command. Default command is run
+
+Returns: string
+*/
+func command() string {
+	var words []string
+
+	for len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		words = append(words, os.Args[1])
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	if len(words) == 0 {
+		return "run"
+	}
+	return strings.Join(words, " ")
+}
+
+/*
+forEachJob calls f for every configured job by pool of c.Concurrency
+workers. Failure of one job doesn't stop others, but jobs aren't started
+after context is done
+
+Returns: []processor.Result: result of every job in configuration order
+*/
+func forEachJob(
+	ctx context.Context,
+	c *config.Config,
+	f func(ctx context.Context, job *config.Job) error,
+) []processor.Result {
+	results := make([]processor.Result, len(c.Jobs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(c.Concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i].Job = &c.Jobs[i]
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+
+				started := time.Now()
+				results[i].Err = f(ctx, &c.Jobs[i])
+				results[i].Took = time.Since(started)
+			}
+		}()
+	}
+
+	for i := range c.Jobs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+/*
+summarize sends summary of backup runs, if several jobs are run, and
+returns failed jobs count
+
+Arguments:
+
+	c *config.Config
+	results []processor.Result
+
+Returns: int
+*/
+func summarize(c *config.Config, results []processor.Result) int {
+	if len(results) > 1 {
+		processor.Summarize(c.DataDir, results)
+	}
+	return failures(results)
+}
+
+// failures returns failed jobs count
+func failures(results []processor.Result) int {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// exit closes program with error code, if some jobs are failed
+func exit(failed int) {
+	if failed != 0 {
+		flush()
+		logger.Fatalf("%d job(s) failed\n", failed)
+	}
+}
+
+// daemon runs jobs by their schedules until context is done
+func daemon(ctx context.Context) {
+	c := config.MustLoad()
+	s, err := scheduler.New(c, func(ctx context.Context, job *config.Job) error {
+		return processor.New(job, c.DataDir).Process(ctx)
+	})
+	if err != nil {
+		logger.Fatalf("Can't start daemon: %v\n", err)
+	}
+
+	if c.MetricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, c.MetricsAddr); err != nil {
+				logger.Errorf("%v\n", err)
+			}
+		}()
+		logger.Infof("Metrics are served on %s/metrics\n", c.MetricsAddr)
+	}
+
+	if c.ApiAddr != "" {
+		go func() {
+			if err := api.New(c, s).Serve(ctx, c.ApiAddr); err != nil {
+				logger.Errorf("%v\n", err)
+			}
+		}()
+		logger.Infof(
+			"Control API is served on %s/api/v1/jobs, dashboard on %s/\n",
+			c.ApiAddr,
+			c.ApiAddr,
+		)
+	}
+
+	s.Run(ctx)
+}
+
+/*
+push sends job metrics to Pushgateway, if it's configured. Metrics are
+pushed even if run is cancelled
+
+Arguments:
+
+	c *config.Config
+	job *config.Job
+*/
+func push(c *config.Config, job *config.Job) {
+	if c.PushgatewayUrl == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := metrics.Push(ctx, c.PushgatewayUrl, job); err != nil {
+		logger.Warningf("%v\n", err)
+	}
+}
+
+// flush exports remaining trace spans before program exits
+func flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := tracing.Shutdown(ctx); err != nil {
+		logger.Warningf("%v\n", err)
+	}
+}
+
+// validate loads configuration and prints all its problems
+func validate() {
+	c, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, j := range c.Jobs {
+		fmt.Printf(
+			"%s: %s backup of %s workspace\n",
+			j.Name,
+			j.BackupType,
+			j.AtlassianWorkspace,
+		)
+	}
+	fmt.Printf("Configuration is valid, %d job(s) found\n", len(c.Jobs))
+}
+
+// status prints state of the last run of every job
+func status() {
+	c := config.MustLoad()
+
+	for _, j := range c.Jobs {
+		r, err := runstate.Load(c.DataDir, j.Name)
+		if err != nil {
+			fmt.Printf("%s: %v\n", j.Name, err)
+			continue
+		}
+		if r == nil {
+			fmt.Printf("%s: no runs\n", j.Name)
+			continue
+		}
+
+		phase := string(r.Phase)
+		if r.Resumable() {
+			phase += ", will be resumed"
+		}
+		fmt.Printf(
+			"%s: run %s %s (started %s, updated %s)\n",
+			j.Name,
+			r.Id,
+			phase,
+			r.Started.Format(time.RFC3339),
+			r.Updated.Format(time.RFC3339),
+		)
+
+		if r.DownloadOnly {
+			fmt.Println("\tmode: download only")
+		}
+		if r.TaskId != "" {
+			fmt.Printf("\ttask ID: %s\n", r.TaskId)
+		}
+		if r.FileUrl != "" {
+			fmt.Printf("\tfile URL: %s\n", r.FileUrl)
+		}
+		if !r.Created.IsZero() {
+			fmt.Printf("\tbackup created: %s\n", r.Created.Format(time.RFC3339))
+		}
+		for _, t := range r.Targets {
+			state := "not saved"
+			if t.Saved {
+				state = "saved, " + t.Size
+			}
+			fmt.Printf("\t%s: %s (%s)\n", t.Type, t.Object, state)
+		}
+		if r.Error != "" {
+			fmt.Printf("\terror: %s\n", r.Error)
+		}
+	}
+}
+
+// printHistory prints finished runs, which match command-line filters
+func printHistory() {
+	job := flag.String("job", "", "Print runs of the job only")
+	outcome := flag.String("outcome", "", "Print runs with outcome only: success, failure or cancelled")
+	since := flag.Duration("since", 0, "Print runs started within duration, e.g. 720h")
+	limit := flag.Int("limit", 20, "Max number of printed runs, 0 means all")
+	format := flag.String("format", "table", "Output format: table or json")
+
+	c := config.MustLoad()
+
+	f := history.Filter{Job: *job, Outcome: *outcome, Limit: *limit}
+	if *since > 0 {
+		f.Since = time.Now().Add(-*since)
+	}
 
-	processor.Process()
+	records, err := history.Read(c.DataDir, f)
+	if err != nil {
+		logger.Fatalf("%v\n", err)
+	}
 
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if records == nil {
+			records = []history.Record{}
+		}
+		if err := enc.Encode(records); err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STARTED\tJOB\tRUN\tOUTCOME\tPHASE\tDURATION\tSIZE\tERROR")
+		for _, r := range records {
+			size := ""
+			if r.SizeBytes > 0 {
+				size = utils.NiceSize(r.SizeBytes)
+			}
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Started.Format(time.RFC3339),
+				r.Job,
+				r.RunId,
+				r.Outcome,
+				r.FailedPhase,
+				r.Duration().Round(time.Second),
+				size,
+				strings.TrimSpace(r.Error),
+			)
+		}
+		_ = w.Flush()
+	default:
+		logger.Fatalf("Output format %q is incorrect\n", *format)
+	}
 }
@@ -0,0 +1,281 @@
+/*
+Package metrics implements Prometheus metrics of backup runs.
+
+Metrics are served on /metrics endpoint in daemon mode (see Serve) and are
+pushed to Pushgateway after one-shot runs (see Push). All metrics have
+workspace and backup_type labels, storage metrics have storage label too:
+
+	atlassian_backup_last_success_timestamp_seconds
+	atlassian_backup_last_run_duration_seconds
+	atlassian_backup_progress_percent
+	atlassian_backup_eta_seconds
+	atlassian_backup_size_bytes{storage}
+	atlassian_backup_download_throughput_bytes_per_second{storage}
+	atlassian_backup_failures_total{phase}
+*/
+package metrics
+
+import (
+	"atlassian_backup/config"
+	"atlassian_backup/lib/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	namespace = "atlassian_backup"
+	// pushJob is Pushgateway job label of pushed metrics
+	pushJob = "atlassian_backup"
+)
+
+// Failure phases
+const (
+	PhaseLock      = "lock"
+	PhasePreflight = "preflight"
+	PhaseStart     = "start"
+	PhaseFollow    = "follow"
+	PhaseFileUrl   = "file_url"
+	PhaseSave      = "save"
+)
+
+var (
+	jobLabels     = []string{"workspace", "backup_type"}
+	storageLabels = []string{"workspace", "backup_type", "storage"}
+	phaseLabels   = []string{"workspace", "backup_type", "phase"}
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	lastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Time of the last successfully saved backup.",
+	}, jobLabels)
+
+	lastDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_duration_seconds",
+		Help:      "Duration of the last backup run.",
+	}, jobLabels)
+
+	progress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "progress_percent",
+		Help:      "Progress of the current cloud backup.",
+	}, jobLabels)
+
+	eta = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "eta_seconds",
+		Help:      "Estimated remaining time of the current cloud backup.",
+	}, jobLabels)
+
+	size = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "size_bytes",
+		Help:      "Size of the last saved backup file.",
+	}, storageLabels)
+
+	throughput = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "download_throughput_bytes_per_second",
+		Help:      "Download speed of the last saved backup file.",
+	}, storageLabels)
+
+	failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failures_total",
+		Help:      "Failed backup runs by pipeline phase.",
+	}, phaseLabels)
+)
+
+func init() {
+	registry.MustRegister(
+		lastSuccess,
+		lastDuration,
+		progress,
+		eta,
+		size,
+		throughput,
+		failures,
+	)
+}
+
+// Progress sets cloud backup progress of job
+func Progress(job *config.Job, percent int) {
+	progress.WithLabelValues(labels(job)...).Set(float64(percent))
+}
+
+// Eta sets estimated remaining time of job cloud backup
+func Eta(job *config.Job, remaining time.Duration) {
+	eta.WithLabelValues(labels(job)...).Set(remaining.Seconds())
+}
+
+// Saved sets backup file size and download throughput of job storage
+func Saved(job *config.Job, storage string, bytes int64, took time.Duration) {
+	l := append(labels(job), storage)
+	size.WithLabelValues(l...).Set(float64(bytes))
+
+	if took > 0 {
+		throughput.WithLabelValues(l...).Set(float64(bytes) / took.Seconds())
+	}
+}
+
+// Finished sets duration of job run and time of success, if run succeeded
+func Finished(job *config.Job, took time.Duration, success bool) {
+	lastDuration.WithLabelValues(labels(job)...).Set(took.Seconds())
+
+	if success {
+		lastSuccess.WithLabelValues(labels(job)...).SetToCurrentTime()
+	}
+}
+
+// Failed counts job run failure in pipeline phase
+func Failed(job *config.Job, phase string) {
+	failures.WithLabelValues(append(labels(job), phase)...).Inc()
+}
+
+/*
+Serve serves metrics on /metrics endpoint until context is done. Returns
+error if server can't be started
+
+Arguments:
+
+	ctx context.Context
+	addr string: listen address, e.g. :9090
+
+Returns: error
+*/
+func Serve(ctx context.Context, addr string) (err error) {
+	defer func() { err = utils.WrapIfErr("can't serve metrics", err) }()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	err = server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+/*
+Push adds metrics of job to Pushgateway. Metrics are grouped by workspace
+and backup type, so pushes of different jobs don't overwrite each other.
+Returns error if failure
+
+Arguments:
+
+	ctx context.Context
+	url string: Pushgateway URL
+	job *config.Job
+
+Returns: error
+*/
+func Push(ctx context.Context, url string, job *config.Job) (err error) {
+	defer func() { err = utils.WrapIfErr("can't push metrics", err) }()
+
+	l := labels(job)
+
+	return push.New(url, pushJob).
+		Gatherer(jobGatherer{workspace: l[0], backupType: l[1]}).
+		Grouping("workspace", l[0]).
+		Grouping("backup_type", l[1]).
+		AddContext(ctx)
+}
+
+// labels returns job labels values
+func labels(job *config.Job) []string {
+	return []string{job.AtlassianWorkspace, job.BackupType}
+}
+
+/*
+A jobGatherer gathers metrics of one job only. Job labels are removed from
+metrics, because Pushgateway sets them from grouping key
+*/
+type jobGatherer struct {
+	workspace  string
+	backupType string
+}
+
+func (g jobGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*dto.MetricFamily
+	for _, f := range families {
+		var metrics []*dto.Metric
+		for _, m := range f.Metric {
+			if labels, ok := g.strip(m.Label); ok {
+				m.Label = labels
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) != 0 {
+			f.Metric = metrics
+			result = append(result, f)
+		}
+	}
+
+	return result, nil
+}
+
+/*
+strip removes job labels from metric labels. Returns false, if metric
+doesn't belong to the job
+
+Arguments:
+
+	labels []*dto.LabelPair
+
+Returns:
+
+	[]*dto.LabelPair
+	bool
+*/
+func (g jobGatherer) strip(labels []*dto.LabelPair) ([]*dto.LabelPair, bool) {
+	var rest []*dto.LabelPair
+	found := 0
+
+	for _, l := range labels {
+		switch l.GetName() {
+		case "workspace":
+			if l.GetValue() != g.workspace {
+				return nil, false
+			}
+			found++
+		case "backup_type":
+			if l.GetValue() != g.backupType {
+				return nil, false
+			}
+			found++
+		default:
+			rest = append(rest, l)
+		}
+	}
+
+	return rest, found == 2
+}
@@ -1,5 +1,195 @@
+// Package notifyer include interface for describe notification object
 package notifyer
 
+import (
+	"atlassian_backup/lib/utils"
+	"fmt"
+	"strings"
+)
+
+/*
+A Notifyer presents notification object
+
+Methods:
+
+	Send(text string) (err error)
+*/
 type Notifyer interface {
 	Send(text string) (err error)
 }
+
+/*
+An Alerter presents notifyer, which opens an alert on failure and resolves it
+on success. Alerts are deduplicated by key, so repeated failures update the
+same alert
+
+Methods:
+
+	Trigger(key, text string) (err error)
+	Resolve(key, text string) (err error)
+*/
+type Alerter interface {
+	Notifyer
+	Trigger(key, text string) (err error)
+	Resolve(key, text string) (err error)
+}
+
+// A Severity presents notification importance level
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+var severityNames = map[Severity]string{
+	Info:    "info",
+	Warning: "warning",
+	Error:   "error",
+}
+
+// String returns severity name
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+/*
+ParseSeverity convert severity name (info, warning or error) to Severity.
+Empty name means Info.
+
+Arguments:
+
+	name string
+
+Returns:
+
+	Severity
+	error
+*/
+func ParseSeverity(name string) (Severity, error) {
+	if name == "" {
+		return Info, nil
+	}
+	for s, n := range severityNames {
+		if strings.EqualFold(name, n) {
+			return s, nil
+		}
+	}
+	return Info, fmt.Errorf("unknown severity %q", name)
+}
+
+/*
+A Route binds notifyer with minimal severity of messages, which should be
+sent through it
+*/
+type Route struct {
+	Name        string
+	Notifyer    Notifyer
+	MinSeverity Severity
+}
+
+/*
+A Router sends messages to every notifyer, which minimal severity is not
+higher than message severity. Alerters get Key as alert deduplication key and
+open alerts for errors only, so warnings, e.g. progress stall or cancelled
+run, don't page anybody
+*/
+type Router struct {
+	Key    string
+	routes []Route
+}
+
+// NewRouter returns new Router object with alert key and given routes
+func NewRouter(key string, routes ...Route) *Router {
+	return &Router{
+		Key:    key,
+		routes: routes,
+	}
+}
+
+// Add appends new route to Router
+func (r *Router) Add(route Route) {
+	r.routes = append(r.routes, route)
+}
+
+/*
+Notify sends text to all matched notifyers. Alerters open an alert for
+error messages and skip info and warning ones. A failure of one notifyer
+doesn't prevent sending to others, all failures are returned as a single
+error.
+
+Arguments:
+
+	s Severity: message severity
+	text string
+
+Returns: error
+*/
+func (r *Router) Notify(s Severity, text string) error {
+	var failures []string
+	text = utils.Redact(text)
+
+	for _, route := range r.routes {
+		if s < route.MinSeverity {
+			continue
+		}
+
+		var err error
+		if a, ok := route.Notifyer.(Alerter); ok {
+			if s < Error {
+				continue
+			}
+			err = a.Trigger(r.Key, text)
+		} else {
+			err = route.Notifyer.Send(text)
+		}
+
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", route.Name, err))
+		}
+	}
+
+	return joinFailures(failures)
+}
+
+/*
+Resolve closes alerts, opened by Notify, in every alerter regardless of its
+minimal severity. Other notifyers are skipped.
+
+Arguments:
+
+	text string: resolution note
+
+Returns: error
+*/
+func (r *Router) Resolve(text string) error {
+	var failures []string
+	text = utils.Redact(text)
+
+	for _, route := range r.routes {
+		a, ok := route.Notifyer.(Alerter)
+		if !ok {
+			continue
+		}
+		if err := a.Resolve(r.Key, text); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", route.Name, err))
+		}
+	}
+
+	return joinFailures(failures)
+}
+
+// joinFailures returns single error for all notifyers failures
+func joinFailures(failures []string) error {
+	if len(failures) != 0 {
+		return fmt.Errorf(
+			"can't send notification: %s",
+			strings.Join(failures, "; "),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Package opsgenie implements notifyer, which creates and closes Opsgenie
+alerts through Alert API.
+*/
+package opsgenie
+
+import (
+	"atlassian_backup/lib/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultApiUrl   = "https://api.opsgenie.com"
+	defaultPriority = "P2"
+	alertsPath      = "/v2/alerts"
+	alertSource     = "atlassian_backup"
+	messageMaxLen   = 130
+)
+
+/*
+A Notifyer is representation of Opsgenie API integration.
+Implements notifyer.Alerter interface
+*/
+type Notifyer struct {
+	apiKey   string
+	apiUrl   string
+	priority string
+}
+
+type alert struct {
+	Message     string `json:"message"`
+	Alias       string `json:"alias,omitempty"`
+	Description string `json:"description,omitempty"`
+	Source      string `json:"source"`
+	Priority    string `json:"priority"`
+}
+
+type closeRequest struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+/*
+New returns new Notifyer object or error if failure.
+
+Arguments:
+
+	key string: API key of Opsgenie integration
+	apiUrl string: API base URL, empty means https://api.opsgenie.com
+	(use https://api.eu.opsgenie.com for EU instance)
+	priority string: alert priority from P1 to P5, empty means P2
+
+Returns:
+
+	*Notifyer
+	error
+*/
+func New(key, apiUrl, priority string) (*Notifyer, error) {
+	if key == "" {
+		return nil, errors.New("Opsgenie API key is not specified")
+	}
+
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	if priority == "" {
+		priority = defaultPriority
+	}
+
+	return &Notifyer{
+		apiKey:   key,
+		apiUrl:   strings.TrimSuffix(apiUrl, "/"),
+		priority: priority,
+	}, nil
+}
+
+// Send creates new Opsgenie alert without alias
+func (n *Notifyer) Send(text string) error {
+	return n.Trigger("", text)
+}
+
+// Trigger creates Opsgenie alert. Alerts with the same alias are deduplicated
+func (n *Notifyer) Trigger(key, text string) error {
+	return n.post(alertsPath, &alert{
+		Message:     truncate(firstLine(text), messageMaxLen),
+		Alias:       key,
+		Description: text,
+		Source:      alertSource,
+		Priority:    n.priority,
+	})
+}
+
+// Resolve closes Opsgenie alert with given alias
+func (n *Notifyer) Resolve(key, text string) error {
+	path := fmt.Sprintf(
+		"%s/%s/close?identifierType=alias",
+		alertsPath,
+		url.PathEscape(key),
+	)
+
+	return n.post(path, &closeRequest{
+		Source: alertSource,
+		Note:   text,
+	})
+}
+
+// post sends request to Opsgenie API
+func (n *Notifyer) post(path string, reqData any) (err error) {
+	defer func() {
+		err = utils.WrapIfErr("can't send request to Opsgenie", err)
+	}()
+
+	body, err := json.Marshal(reqData)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		n.apiUrl+path,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", "GenieKey "+n.apiKey)
+
+	c := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusAccepted {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response %s: %s", resp.Status, data)
+	}
+
+	return nil
+}
+
+// firstLine returns text till the first line break
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+// truncate cuts text to max runes
+func truncate(text string, max int) string {
+	r := []rune(text)
+	if len(r) <= max {
+		return text
+	}
+	return string(r[:max])
+}
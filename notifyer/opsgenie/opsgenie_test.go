@@ -0,0 +1,142 @@
+package opsgenie
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const key = "atlassian_backup/example/confluence"
+
+// request presents request received by fake Alert API
+type request struct {
+	Path  string
+	Query string
+	Auth  string
+	Body  map[string]string
+}
+
+// fakeApi is fake Alert API, which records requests and answers status
+type fakeApi struct {
+	mu       sync.Mutex
+	status   int
+	requests []request
+}
+
+func (f *fakeApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, request{
+		Path:  r.URL.EscapedPath(),
+		Query: r.URL.RawQuery,
+		Auth:  r.Header.Get("Authorization"),
+		Body:  body,
+	})
+	w.WriteHeader(f.status)
+	_, _ = w.Write([]byte(`{"result":"Request will be processed","requestId":"1"}`))
+}
+
+func newFake(t *testing.T, status int) (*fakeApi, *Notifyer) {
+	t.Helper()
+
+	f := &fakeApi{status: status}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	n, err := New("api-key", srv.URL+"/", "")
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	return f, n
+}
+
+func TestTriggerResolve(t *testing.T) {
+	f, n := newFake(t, http.StatusAccepted)
+
+	text := "Confluence backup failed\ncan't get backup progress"
+	if err := n.Trigger(key, text); err != nil {
+		t.Fatalf("Trigger error: %v", err)
+	}
+	if err := n.Resolve(key, "Confluence backup saved"); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+
+	if len(f.requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(f.requests))
+	}
+
+	create := f.requests[0]
+	if create.Path != alertsPath || create.Auth != "GenieKey api-key" {
+		t.Errorf("create request = %+v", create)
+	}
+	want := map[string]string{
+		"message":     "Confluence backup failed",
+		"alias":       key,
+		"description": text,
+		"source":      alertSource,
+		"priority":    defaultPriority,
+	}
+	for k, v := range want {
+		if create.Body[k] != v {
+			t.Errorf("create %s = %q, want %q", k, create.Body[k], v)
+		}
+	}
+
+	closing := f.requests[1]
+	wantPath := alertsPath + "/atlassian_backup%2Fexample%2Fconfluence/close"
+	if closing.Path != wantPath || closing.Query != "identifierType=alias" {
+		t.Errorf("close request path %s?%s, want %s?identifierType=alias",
+			closing.Path, closing.Query, wantPath)
+	}
+	if closing.Body["source"] != alertSource || closing.Body["note"] != "Confluence backup saved" {
+		t.Errorf("close body = %v", closing.Body)
+	}
+}
+
+func TestUnexpectedStatus(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusUnauthorized, http.StatusUnprocessableEntity} {
+		_, n := newFake(t, status)
+
+		err := n.Trigger(key, "Confluence backup failed")
+		if err == nil {
+			t.Errorf("status %d: no error", status)
+			continue
+		}
+		if !strings.Contains(err.Error(), "unexpected response") {
+			t.Errorf("status %d: error %q", status, err)
+		}
+	}
+}
+
+func TestMessageTruncation(t *testing.T) {
+	f, n := newFake(t, http.StatusAccepted)
+
+	text := strings.Repeat("ж", messageMaxLen+10) + "\ndetails"
+	if err := n.Trigger(key, text); err != nil {
+		t.Fatalf("Trigger error: %v", err)
+	}
+
+	body := f.requests[0].Body
+	if got := []rune(body["message"]); len(got) != messageMaxLen {
+		t.Errorf("message length = %d runes, want %d", len(got), messageMaxLen)
+	}
+	if body["description"] != text {
+		t.Errorf("description is changed: %q", body["description"])
+	}
+}
+
+func TestNewWithoutKey(t *testing.T) {
+	if _, err := New("", "", ""); err == nil {
+		t.Error("New without API key: no error")
+	}
+}
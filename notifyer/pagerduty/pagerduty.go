@@ -0,0 +1,140 @@
+/*
+Package pagerduty implements notifyer, which opens and resolves PagerDuty
+incidents through Events API v2.
+*/
+package pagerduty
+
+import (
+	"atlassian_backup/lib/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultEventsUrl = "https://events.pagerduty.com/v2/enqueue"
+	eventSource      = "atlassian_backup"
+	eventSeverity    = "error"
+	summaryMaxLen    = 1024
+)
+
+/*
+A Notifyer is representation of PagerDuty service integration.
+Implements notifyer.Alerter interface
+*/
+type Notifyer struct {
+	routingKey string
+	eventsUrl  string
+}
+
+type event struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key,omitempty"`
+	Payload     *payload `json:"payload,omitempty"`
+}
+
+type payload struct {
+	Summary  string `json:"summary"`
+	Source   string `json:"source"`
+	Severity string `json:"severity"`
+}
+
+/*
+New returns new Notifyer object or error if failure.
+
+Arguments:
+
+	key string: integration key of PagerDuty service
+	eventsUrl string: Events API endpoint, empty means
+	https://events.pagerduty.com/v2/enqueue
+
+Returns:
+
+	*Notifyer
+	error
+*/
+func New(key, eventsUrl string) (*Notifyer, error) {
+	if key == "" {
+		return nil, errors.New("PagerDuty routing key is not specified")
+	}
+
+	if eventsUrl == "" {
+		eventsUrl = defaultEventsUrl
+	}
+
+	return &Notifyer{
+		routingKey: key,
+		eventsUrl:  eventsUrl,
+	}, nil
+}
+
+// Send opens new PagerDuty incident without deduplication key
+func (n *Notifyer) Send(text string) error {
+	return n.Trigger("", text)
+}
+
+// Trigger opens PagerDuty incident or updates existing one with the same key
+func (n *Notifyer) Trigger(key, text string) error {
+	return n.enqueue(&event{
+		RoutingKey:  n.routingKey,
+		EventAction: "trigger",
+		DedupKey:    key,
+		Payload: &payload{
+			Summary:  truncate(text, summaryMaxLen),
+			Source:   eventSource,
+			Severity: eventSeverity,
+		},
+	})
+}
+
+// Resolve closes PagerDuty incident with given key, if it's open
+func (n *Notifyer) Resolve(key, text string) error {
+	return n.enqueue(&event{
+		RoutingKey:  n.routingKey,
+		EventAction: "resolve",
+		DedupKey:    key,
+	})
+}
+
+// enqueue sends event to PagerDuty Events API
+func (n *Notifyer) enqueue(e *event) (err error) {
+	defer func() {
+		err = utils.WrapIfErr("can't send event to PagerDuty", err)
+	}()
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	c := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	resp, err := c.Post(n.eventsUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusAccepted {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response %s: %s", resp.Status, data)
+	}
+
+	return nil
+}
+
+// truncate cuts text to max runes
+func truncate(text string, max int) string {
+	r := []rune(text)
+	if len(r) <= max {
+		return text
+	}
+	return string(r[:max])
+}
@@ -0,0 +1,131 @@
+package pagerduty
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const key = "atlassian_backup/example/jira"
+
+// fakeEvents is fake Events API, which records events and answers status
+type fakeEvents struct {
+	mu     sync.Mutex
+	status int
+	events []event
+}
+
+func (f *fakeEvents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var e event
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.events = append(f.events, e)
+	w.WriteHeader(f.status)
+	_, _ = w.Write([]byte(`{"status":"success","message":"Event processed"}`))
+}
+
+func newFake(t *testing.T, status int) (*fakeEvents, *Notifyer) {
+	t.Helper()
+
+	f := &fakeEvents{status: status}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	n, err := New("routing-key", srv.URL)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	return f, n
+}
+
+func TestTriggerResolve(t *testing.T) {
+	f, n := newFake(t, http.StatusAccepted)
+
+	if err := n.Trigger(key, "Jira backup failed"); err != nil {
+		t.Fatalf("Trigger error: %v", err)
+	}
+	if err := n.Trigger(key, "Jira backup failed again"); err != nil {
+		t.Fatalf("Trigger error: %v", err)
+	}
+	if err := n.Resolve(key, "Jira backup saved"); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+
+	if len(f.events) != 3 {
+		t.Fatalf("got %d events, want 3", len(f.events))
+	}
+
+	for i, e := range f.events[:2] {
+		if e.RoutingKey != "routing-key" || e.EventAction != "trigger" || e.DedupKey != key {
+			t.Errorf("trigger event %d = %+v", i, e)
+		}
+		if e.Payload == nil ||
+			e.Payload.Source != eventSource ||
+			e.Payload.Severity != eventSeverity {
+			t.Errorf("trigger event %d payload = %+v", i, e.Payload)
+		}
+	}
+	if f.events[0].Payload.Summary != "Jira backup failed" {
+		t.Errorf("summary = %q", f.events[0].Payload.Summary)
+	}
+
+	resolve := f.events[2]
+	if resolve.EventAction != "resolve" || resolve.DedupKey != key || resolve.Payload != nil {
+		t.Errorf("resolve event = %+v", resolve)
+	}
+}
+
+func TestSendHasNoDedupKey(t *testing.T) {
+	f, n := newFake(t, http.StatusAccepted)
+
+	if err := n.Send("summary"); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if f.events[0].DedupKey != "" {
+		t.Errorf("dedup key = %q, want empty", f.events[0].DedupKey)
+	}
+}
+
+func TestUnexpectedStatus(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest, http.StatusTooManyRequests} {
+		_, n := newFake(t, status)
+
+		err := n.Trigger(key, "Jira backup failed")
+		if err == nil {
+			t.Errorf("status %d: no error", status)
+			continue
+		}
+		if !strings.Contains(err.Error(), "unexpected response") {
+			t.Errorf("status %d: error %q", status, err)
+		}
+	}
+}
+
+func TestSummaryTruncation(t *testing.T) {
+	f, n := newFake(t, http.StatusAccepted)
+
+	text := strings.Repeat("ж", summaryMaxLen+10)
+	if err := n.Trigger(key, text); err != nil {
+		t.Fatalf("Trigger error: %v", err)
+	}
+
+	summary := []rune(f.events[0].Payload.Summary)
+	if len(summary) != summaryMaxLen {
+		t.Errorf("summary length = %d runes, want %d", len(summary), summaryMaxLen)
+	}
+}
+
+func TestNewWithoutKey(t *testing.T) {
+	if _, err := New("", ""); err == nil {
+		t.Error("New without routing key: no error")
+	}
+}
@@ -4,7 +4,6 @@ package slack
 import (
 	"atlassian_backup/lib/utils"
 	"errors"
-	"os"
 
 	"github.com/slack-go/slack"
 )
@@ -15,9 +14,8 @@ type Notifyer struct {
 	webhookUrl string
 }
 
-func New() (*Notifyer, error) {
-	webhook, ok := os.LookupEnv("SLACK_WEBHOOK_URL")
-	if !ok {
+func New(webhook string) (*Notifyer, error) {
+	if webhook == "" {
 		return nil, errors.New("Slack webhook URL is not specified")
 	}
 
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"atlassian_backup/lib/utils"
+	"atlassian_backup/storage"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// A SavedBackup presents backup file saved in job storage target
+type SavedBackup struct {
+	Storage string
+	storage.Object
+}
+
+/*
+Progress returns progress of the latest cloud backup of the job from
+Atlassian API or error if failure. Nothing is logged or notified, so it can
+be polled by API clients
+
+Arguments:
+
+	ctx context.Context
+
+Returns:
+
+	int: progress percent
+	error
+*/
+func (p *Processor) Progress(ctx context.Context) (int, error) {
+	return p.backup().Progress(ctx)
+}
+
+/*
+Backups returns backup files saved in all storage targets of the job, the
+latest first, or error if some storage can't be listed. Nothing is logged or
+notified
+
+Arguments:
+
+	ctx context.Context
+
+Returns:
+
+	backups []SavedBackup
+	err error
+*/
+func (p *Processor) Backups(ctx context.Context) (backups []SavedBackup, err error) {
+	defer func() { err = utils.WrapIfErr("can't list saved backups", err) }()
+
+	for _, target := range p.job.Storages {
+		s, err := p.storage(target)
+		if err != nil {
+			return nil, err
+		}
+
+		l, ok := s.(storage.Lister)
+		if !ok {
+			return nil, fmt.Errorf("%s storage doesn't support listing", target.Type)
+		}
+
+		objects, err := l.List(ctx, p.objPrefix(target))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range objects {
+			backups = append(backups, SavedBackup{Storage: target.Type, Object: o})
+		}
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Modified.After(backups[j].Modified)
+	})
+
+	return backups, nil
+}
@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"atlassian_backup/config"
+	"time"
+)
+
+/*
+A poller tracks cloud backup progress: it chooses next polling interval,
+estimates remaining time and detects progress stall. Interval is reset to
+initial one, when progress moves, and doubles up to max one, while it
+stands still
+*/
+type poller struct {
+	config.Poll
+	interval time.Duration
+
+	// first is the first observed progress, ETA is estimated from average
+	// speed since then
+	first     int
+	firstTime time.Time
+	last      int
+	// moved is the time of the last progress change or polling start
+	moved   time.Time
+	stalled bool
+}
+
+/*
+newPoller returns poller with initial interval. Stall is counted since
+polling start, so backup, which progress is never reported, is stalled too
+
+Arguments:
+
+	c config.Poll
+	now time.Time: polling start
+
+Returns: *poller
+*/
+func newPoller(c config.Poll, now time.Time) *poller {
+	return &poller{Poll: c, interval: c.InitialInterval, first: -1, moved: now}
+}
+
+/*
+observe records progress and updates polling interval
+
+Arguments:
+
+	now time.Time
+	percent int
+
+Returns: bool: whether progress moved since previous observation
+*/
+func (pl *poller) observe(now time.Time, percent int) bool {
+	if pl.first < 0 {
+		pl.first, pl.firstTime = percent, now
+		pl.last, pl.moved = percent, now
+		return true
+	}
+
+	if percent != pl.last {
+		pl.last, pl.moved = percent, now
+		pl.interval = pl.InitialInterval
+		return true
+	}
+
+	pl.interval = min(2*pl.interval, pl.MaxInterval)
+	return false
+}
+
+// next returns delay before the next progress check
+func (pl *poller) next() time.Duration {
+	return pl.interval
+}
+
+/*
+eta estimates remaining time of cloud backup by average progress speed.
+Returns false, if progress hasn't moved since the first observation
+
+Arguments:
+
+	now time.Time
+
+Returns:
+
+	time.Duration
+	bool
+*/
+func (pl *poller) eta(now time.Time) (time.Duration, bool) {
+	done := pl.last - pl.first
+	if pl.first < 0 || done <= 0 {
+		return 0, false
+	}
+
+	perPercent := now.Sub(pl.firstTime) / time.Duration(done)
+	return perPercent * time.Duration(100-pl.last), true
+}
+
+/*
+stall reports progress stall once per stall: it returns true, when progress
+hasn't moved for stall timeout, and resets, when progress moves
+
+Arguments:
+
+	now time.Time
+
+Returns: bool
+*/
+func (pl *poller) stall(now time.Time) bool {
+	if pl.StallTimeout == 0 || pl.stalled || now.Sub(pl.moved) < pl.StallTimeout {
+		return false
+	}
+	pl.stalled = true
+	return true
+}
+
+/*
+unstall resets reported stall, it's called, when progress moves. Returns
+true, if stall was reported
+
+Returns: bool
+*/
+func (pl *poller) unstall() bool {
+	stalled := pl.stalled
+	pl.stalled = false
+	return stalled
+}
+
+// etaText formats remaining time estimation for messages
+func (pl *poller) etaText(now time.Time) string {
+	eta, ok := pl.eta(now)
+	if !ok {
+		return "unknown"
+	}
+	return eta.Round(time.Minute).String()
+}
@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"atlassian_backup/config"
+	"testing"
+	"time"
+)
+
+var pollConfig = config.Poll{
+	InitialInterval: 10 * time.Second,
+	MaxInterval:     time.Minute,
+	StallTimeout:    time.Hour,
+}
+
+func TestPollerInterval(t *testing.T) {
+	t0 := time.Now()
+	pl := newPoller(pollConfig, t0)
+
+	if pl.next() != 10*time.Second {
+		t.Fatalf("initial interval = %s", pl.next())
+	}
+
+	pl.observe(t0, 10)
+	// Interval doubles, while progress stands still, up to max one
+	for _, want := range []time.Duration{
+		20 * time.Second,
+		40 * time.Second,
+		time.Minute,
+		time.Minute,
+	} {
+		if moved := pl.observe(t0, 10); moved {
+			t.Fatal("progress isn't moved, but observe reports move")
+		}
+		if pl.next() != want {
+			t.Errorf("interval = %s, want %s", pl.next(), want)
+		}
+	}
+
+	// Moved progress resets interval
+	if moved := pl.observe(t0, 11); !moved {
+		t.Fatal("progress is moved, but observe doesn't report it")
+	}
+	if pl.next() != 10*time.Second {
+		t.Errorf("interval after move = %s, want 10s", pl.next())
+	}
+}
+
+func TestPollerEta(t *testing.T) {
+	t0 := time.Now()
+	pl := newPoller(pollConfig, t0)
+
+	if _, ok := pl.eta(t0); ok {
+		t.Error("ETA is estimated without progress")
+	}
+
+	pl.observe(t0, 10)
+	if _, ok := pl.eta(t0.Add(time.Minute)); ok {
+		t.Error("ETA is estimated without progress move")
+	}
+	if pl.etaText(t0) != "unknown" {
+		t.Errorf("ETA text = %q, want unknown", pl.etaText(t0))
+	}
+
+	// 20% per 20 minutes is 1 minute per percent, 70% remain
+	pl.observe(t0.Add(20*time.Minute), 30)
+	eta, ok := pl.eta(t0.Add(20 * time.Minute))
+	if !ok || eta != 70*time.Minute {
+		t.Errorf("ETA = %s, %v, want 70m", eta, ok)
+	}
+
+	// Average speed since the first observation is used: 30% per hour
+	pl.observe(t0.Add(60*time.Minute), 40)
+	if eta, _ := pl.eta(t0.Add(60 * time.Minute)); eta != 2*time.Hour {
+		t.Errorf("ETA = %s, want 2h", eta)
+	}
+	if pl.etaText(t0.Add(60*time.Minute)) != "2h0m0s" {
+		t.Errorf("ETA text = %q", pl.etaText(t0.Add(60*time.Minute)))
+	}
+}
+
+func TestPollerStall(t *testing.T) {
+	t0 := time.Now()
+	pl := newPoller(pollConfig, t0)
+
+	pl.observe(t0, 10)
+	if pl.stall(t0.Add(59 * time.Minute)) {
+		t.Error("stall is reported before timeout")
+	}
+	if !pl.stall(t0.Add(time.Hour)) {
+		t.Fatal("stall isn't reported after timeout")
+	}
+	// Stall is reported once
+	if pl.stall(t0.Add(2 * time.Hour)) {
+		t.Error("stall is reported twice")
+	}
+
+	// Progress move resets stall, so the next stall is reported again
+	t1 := t0.Add(2 * time.Hour)
+	if !pl.observe(t1, 20) || !pl.unstall() {
+		t.Fatal("reported stall isn't reset by progress move")
+	}
+	if pl.unstall() {
+		t.Error("stall is reset twice")
+	}
+	if pl.stall(t1.Add(30 * time.Minute)) {
+		t.Error("stall is reported before timeout since move")
+	}
+	if !pl.stall(t1.Add(time.Hour)) {
+		t.Error("the next stall isn't reported")
+	}
+}
+
+func TestPollerStallWithoutProgress(t *testing.T) {
+	t0 := time.Now()
+
+	// Progress is never reported, stall is counted since polling start
+	pl := newPoller(pollConfig, t0)
+	if pl.stall(t0.Add(time.Minute)) {
+		t.Error("stall is reported right after start")
+	}
+	if !pl.stall(t0.Add(time.Hour)) {
+		t.Error("stall of unreported progress isn't reported")
+	}
+
+	// Zero stall timeout disables detection
+	c := pollConfig
+	c.StallTimeout = 0
+	pl = newPoller(c, t0)
+	if pl.stall(t0.Add(24 * time.Hour)) {
+		t.Error("stall is reported with zero timeout")
+	}
+}
@@ -6,17 +6,33 @@ import (
 	"atlassian_backup/backup/confluence"
 	"atlassian_backup/backup/jira"
 	"atlassian_backup/config"
+	"atlassian_backup/heartbeat"
+	"atlassian_backup/history"
 	"atlassian_backup/lib/utils"
+	"atlassian_backup/lock"
 	"atlassian_backup/logger"
+	"atlassian_backup/metrics"
 	"atlassian_backup/notifyer"
+	"atlassian_backup/notifyer/opsgenie"
+	"atlassian_backup/notifyer/pagerduty"
 	"atlassian_backup/notifyer/slack"
+	"atlassian_backup/runstate"
 	"atlassian_backup/storage"
 	"atlassian_backup/storage/gs"
 	"atlassian_backup/storage/local"
+	"atlassian_backup/tracing"
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -26,98 +42,916 @@ const (
 	errInitStorage = "Can't initialize %s storage: %v\n"
 	errSaveMsg     = "Saving backup to %s failure: %v\n"
 	successMsg     = "Backup %s successfully saved! Backup size: %s\n"
+	errListMsg     = "Can't list %s backups: %v\n"
+	errOverdueMsg  = "%s backup is overdue: %v\n"
+	errRetainMsg   = "Can't remove expired %s backups: %v\n"
+	errPreflight   = "%s storage preflight check failure: %v\n"
+	cancelMsg      = "%s backup is cancelled: %v\n"
+	errNoBackupMsg = "There is no completed %s cloud backup: %v\n"
+	errLockMsg     = "Can't acquire %s backup run lock: %v\n"
+	stallMsg       = "%s cloud backup progress is stalled: %v\n"
+	unstallMsg     = "%s cloud backup progress moved to %d%%, ETA is %s\n"
 )
 
-// A Processor object
+// A failure presents job error, which is already logged and notified
+type failure struct {
+	text string
+	err  error
+}
+
+func (f *failure) Error() string { return f.text }
+
+func (f *failure) Unwrap() error { return f.err }
+
+// A Processor object handles one backup job
 type Processor struct {
-	config *config.Config
+	job     *config.Job
+	dataDir string
+	// phase is the current pipeline phase for failure metrics
+	phase string
+	log   *logger.Logger
 }
 
 /*
 New create new Processor object
 
+Arguments:
+
+	job *config.Job
+	dataDir string: application data folder for run state
+
 Returns: *Processor
 */
-func New() *Processor {
+func New(job *config.Job, dataDir string) *Processor {
 	return &Processor{
-		config: config.MustLoad(),
+		job:     job,
+		dataDir: dataDir,
+		log: logger.With(
+			"job", job.Name,
+			"workspace", job.AtlassianWorkspace,
+			"backup_type", job.BackupType,
+		),
 	}
 }
 
 /*
 Process handle backup pileline. In the beginning run cloud backup procedure,
-then check backup progress and download backup file to storage
+then check backup progress and download backup file to storage. Failure is
+notified and returned as error. Process is aborted, when context is done.
+
+Run state is saved after every phase, so interrupted run is resumed from the
+interrupted phase by the next call
+
+Arguments:
+
+	ctx context.Context
+
+Returns: error
+*/
+func (p *Processor) Process(ctx context.Context) error {
+	return p.process(ctx, false)
+}
+
+/*
+Download saves the latest completed cloud backup to storage without running
+new backup, e.g. backup, which was run manually in Atlassian UI. Failure is
+notified and returned as error
+
+Arguments:
+
+	ctx context.Context
+
+Returns: error
+*/
+func (p *Processor) Download(ctx context.Context) error {
+	return p.process(ctx, true)
+}
+
+/*
+process handle backup pipeline. Cloud backup isn't run and followed in
+download only mode
+
+Arguments:
+
+	ctx context.Context
+	downloadOnly bool
+
+Returns: error
 */
-func (p *Processor) Process() {
-	logger.Init()
+func (p *Processor) process(ctx context.Context, downloadOnly bool) (err error) {
+	l, ctx, err := p.lock(ctx)
+	if errors.Is(err, lock.ErrLocked) {
+		metrics.Failed(p.job, metrics.PhaseLock)
+		p.log.Warningf("Job %s is skipped: %v\n", p.job.Name, err)
+		return err
+	}
+	if err != nil {
+		// Lock storage failure, e.g. denied access to bucket, isn't a
+		// concurrent run, so it's notified and recorded as failed run
+		p.phase = metrics.PhaseLock
+		err = p.handleErr(errLockMsg, p.job.BackupType, err)
+		p.record(runstate.New(p.dataDir, p.job.Name, downloadOnly), err)
+		return err
+	}
+	defer p.unlock(l)
+
+	started := time.Now()
+	defer func() { metrics.Finished(p.job, time.Since(started), err == nil) }()
 
 	b := p.backup()
+	r := p.runState(downloadOnly)
+	defer func() { p.finish(r, err) }()
+	p.log = p.log.With("run_id", r.Id)
 
-	logger.Info.Printf(
-		"Start %s cloud backup process",
-		strings.Title(p.config.BackupType),
+	// Resumed run follows its own task, not the last one of the site
+	if t, ok := b.(backup.Tasker); ok && r.TaskId != "" {
+		t.SetTaskId(r.TaskId)
+	}
+
+	// Run timed out isn't cancelled one, so it isn't resumed
+	ctx, cancel := utils.WithTimeout(ctx, "run", p.job.Timeouts.Run)
+	defer cancel()
+	defer func() { err = utils.TimeoutCause(ctx, err) }()
+
+	ctx, span := tracing.Start(ctx, "backup.run",
+		attribute.String("job", p.job.Name),
+		attribute.String("workspace", p.job.AtlassianWorkspace),
+		attribute.String("backup_type", p.job.BackupType),
+		attribute.String("run_id", r.Id),
+		attribute.Bool("download_only", downloadOnly),
+		attribute.String("resumed_phase", string(r.Phase)),
 	)
-	err := b.Run()
+	defer func() { tracing.End(span, err) }()
+
+	p.ping(heartbeat.Start, "")
+
+	p.phase = metrics.PhasePreflight
+	storages, err := p.preflight(ctx)
 	if err != nil {
-		p.handleErr(
-			errStartMsg,
-			p.config.BackupType,
+		return err
+	}
+
+	if err := p.generate(ctx, b, r, downloadOnly); err != nil {
+		return err
+	}
+
+	file, err := p.file(ctx, b, r)
+	if err != nil {
+		return err
+	}
+
+	size, err := p.save(ctx, file, r, storages)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf(
+		"Backup %s successfully saved! Backup size is: %s",
+		strings.Title(p.job.BackupType),
+		size,
+	)
+	if downloadOnly {
+		text += ", backup is created at: " + createdText(r.Created)
+	}
+
+	_, notifySpan := tracing.Start(ctx, "backup.notify")
+	p.notify(notifyer.Info, text)
+	p.resolve(fmt.Sprintf(
+		"Backup %s successfully saved",
+		strings.Title(p.job.BackupType),
+	))
+	p.ping(heartbeat.Success, fmt.Sprintf("Backup size is: %s", size))
+	notifySpan.End()
+
+	p.log.Infof("%s", text)
+
+	return nil
+}
+
+/*
+generate runs cloud backup and waits for its completion within generation
+timeout. Interrupted run is followed without starting new backup, download
+only run checks, that the latest backup is completed. Failure is notified
+and returned as error
+
+Arguments:
+
+	ctx context.Context
+	b backup.Backup
+	r *runstate.Run
+	downloadOnly bool
+
+Returns: error
+*/
+func (p *Processor) generate(
+	ctx context.Context,
+	b backup.Backup,
+	r *runstate.Run,
+	downloadOnly bool,
+) error {
+	ctx, cancel := utils.WithTimeout(ctx, "generation", p.job.Timeouts.Generation)
+	defer cancel()
+
+	switch {
+	case r.Phase == runstate.Downloading:
+		return nil
+	case downloadOnly:
+		return p.completed(ctx, b)
+	case r.Phase == runstate.Following:
+		return p.follow(ctx, b)
+	default:
+		if err := p.start(ctx, b, r); err != nil {
+			return err
+		}
+		return p.follow(ctx, b)
+	}
+}
+
+/*
+completed checks, that the latest cloud backup is completed, in download
+only mode. Failure is notified and returned as error
+
+Arguments:
+
+	ctx context.Context
+	b backup.Backup
+
+Returns: error
+*/
+func (p *Processor) completed(ctx context.Context, b backup.Backup) (err error) {
+	p.phase = metrics.PhaseFollow
+
+	ctx, span := tracing.Start(ctx, "backup.poll")
+	defer func() { tracing.End(span, err) }()
+
+	progress, err := b.Progress(ctx)
+	if err != nil {
+		return p.handleErr(errFollowMsg, p.job.BackupType, utils.TimeoutCause(ctx, err))
+	}
+	if progress != 100 {
+		return p.handleErr(errNoBackupMsg, p.job.BackupType, fmt.Errorf(
+			"the latest backup is in progress: %d%%",
+			progress,
+		))
+	}
+
+	return nil
+}
+
+/*
+file returns backup file download request. Backup file creation time and
+URL are saved to run state, when download phase starts. Failure is notified
+and returned as error
+
+Arguments:
+
+	ctx context.Context
+	b backup.Backup
+	r *runstate.Run
+
+Returns:
+
+	*http.Request
+	error
+*/
+func (p *Processor) file(
+	ctx context.Context,
+	b backup.Backup,
+	r *runstate.Run,
+) (file *http.Request, err error) {
+	p.phase = metrics.PhaseFileUrl
+
+	ctx, span := tracing.Start(ctx, "backup.resolve_url")
+	defer func() { tracing.End(span, err) }()
+
+	file, err = b.File(ctx)
+	if err != nil {
+		return nil, p.handleErr(
+			errGetUrlMsg,
+			p.job.BackupType,
+			utils.TimeoutCause(ctx, err),
+		)
+	}
+
+	if r.Phase != runstate.Downloading {
+		r.Created = p.created(ctx, file)
+		r.FileUrl = file.URL.Redacted()
+		p.setPhase(r, runstate.Downloading)
+	}
+
+	return file, nil
+}
+
+/*
+save downloads backup file to every storage target, which hasn't saved it
+yet, and removes expired backups. Failure is notified and returned as error
+
+Arguments:
+
+	ctx context.Context
+	file *http.Request
+	r *runstate.Run
+	storages []storage.Storage
+
+Returns:
+
+	size string: human-readable backup file size
+	err error
+*/
+func (p *Processor) save(
+	ctx context.Context,
+	file *http.Request,
+	r *runstate.Run,
+	storages []storage.Storage,
+) (size string, err error) {
+	p.phase = metrics.PhaseSave
+	fName := p.fileName(r.Created)
+
+	for i, target := range p.job.Storages {
+		t := r.Target(i, target.Type, p.objPrefix(target)+fName)
+		if t.Saved {
+			p.log.Infof(
+				"Backup file is already saved to %s storage, skipped\n",
+				target.Type,
+			)
+			size = t.Size
+			continue
+		}
+
+		p.log.Infof(
+			"%s cloud backup success. Downloading backup file to %s storage...\n",
+			strings.Title(p.job.BackupType),
+			target.Type,
+		)
+
+		s := storages[i]
+
+		saveCtx, span := tracing.Start(ctx, "backup.save",
+			attribute.String("storage", target.Type),
+			attribute.String("object", t.Object),
+		)
+		saveStarted := time.Now()
+		bytes, err := s.Save(saveCtx, file, t.Object)
+		span.SetAttributes(attribute.Int64("bytes", bytes))
+		tracing.End(span, err)
+		if err != nil {
+			return "", p.handleErr(errSaveMsg, target.Type, utils.TimeoutCause(ctx, err))
+		}
+		metrics.Saved(p.job, target.Type, bytes, time.Since(saveStarted))
+
+		size = utils.NiceSize(bytes)
+		t.Size, t.Bytes, t.Saved = size, bytes, true
+		p.setPhase(r, runstate.Downloading)
+
+		retainCtx, span := tracing.Start(ctx, "backup.retain",
+			attribute.String("storage", target.Type),
+		)
+		p.retain(retainCtx, target, s)
+		span.End()
+	}
+
+	return size, nil
+}
+
+/*
+start runs cloud backup. Backup, which is already in progress, is followed
+instead of new one. Failure is notified and returned as error
+
+Arguments:
+
+	ctx context.Context
+	b backup.Backup
+	r *runstate.Run
+
+Returns: error
+*/
+func (p *Processor) start(
+	ctx context.Context,
+	b backup.Backup,
+	r *runstate.Run,
+) (err error) {
+	p.phase = metrics.PhaseStart
+
+	ctx, span := tracing.Start(ctx, "backup.trigger")
+	defer func() { tracing.End(span, err) }()
+
+	p.log.Infof(
+		"Start %s cloud backup process",
+		strings.Title(p.job.BackupType),
+	)
+	err = b.Run(ctx)
+	if errors.Is(err, backup.ErrInProgress) {
+		span.SetAttributes(attribute.Bool("reattached", true))
+		p.log.Warningf(
+			"%s cloud backup isn't started: %v. Following the existing backup\n",
+			strings.Title(p.job.BackupType),
 			err,
 		)
+	} else if err != nil {
+		return p.handleErr(
+			errStartMsg,
+			p.job.BackupType,
+			utils.TimeoutCause(ctx, err),
+		)
 	}
 
+	r.Accepted = time.Now()
+	if t, ok := b.(backup.Tasker); ok {
+		id, err := t.TaskId(ctx)
+		if err != nil {
+			p.log.Warningf("Can't get backup task ID: %v\n", err)
+		}
+		r.TaskId = id
+	}
+	p.setPhase(r, runstate.Following)
+
+	return nil
+}
+
+/*
+follow waits for cloud backup completion. Failure is notified and returned
+as error
+
+Arguments:
+
+	ctx context.Context
+	b backup.Backup
+
+Returns: error
+*/
+func (p *Processor) follow(ctx context.Context, b backup.Backup) (err error) {
+	p.phase = metrics.PhaseFollow
+
+	ctx, span := tracing.Start(ctx, "backup.poll")
+	defer func() { tracing.End(span, err) }()
+
+	// Transient progress check failures don't fail the backup, which keeps
+	// running on Atlassian side, until too many checks in a row fail
+	failures := 0
+	pl := newPoller(p.job.Poll, time.Now())
 	for {
-		progress, err := b.Progress()
+		progress, err := b.Progress(ctx)
+		now := time.Now()
+
+		// stalled describes stall, if it's detected after this check. Stall
+		// is detected, when progress isn't moved, isn't reported or can't be
+		// checked
+		var stalled error
+		switch {
+		case errors.Is(err, backup.ErrUnknownProgress):
+			// Backup is running, but its progress isn't reported yet
+			failures = 0
+			p.log.Infof("Current backup %s progress is unknown: %v\n", p.job.BackupType, err)
+			stalled = fmt.Errorf(
+				"its progress isn't reported for %s",
+				now.Sub(pl.moved).Round(time.Second),
+			)
+		case err != nil:
+			err = utils.TimeoutCause(ctx, err)
+			failures++
+			if !utils.Retryable(err) || failures >= p.job.Retry.MaxAttempts {
+				return p.handleErr(errFollowMsg, p.job.BackupType, err)
+			}
+			p.log.Warningf(
+				"Can't check backup %s progress (%d of %d): %v\n",
+				p.job.BackupType,
+				failures,
+				p.job.Retry.MaxAttempts,
+				err,
+			)
+			stalled = fmt.Errorf(
+				"it isn't moved for %s, the last check failed: %w",
+				now.Sub(pl.moved).Round(time.Second),
+				err,
+			)
+		default:
+			failures = 0
+			moved := pl.observe(now, progress)
+
+			metrics.Progress(p.job, progress)
+			if eta, ok := pl.eta(now); ok {
+				metrics.Eta(p.job, eta)
+			}
+			span.AddEvent("progress", trace.WithAttributes(
+				attribute.Int("percent", progress),
+			))
+			p.log.Infof(
+				"Current backup %s progress is: %d%%, ETA is %s\n",
+				p.job.BackupType,
+				progress,
+				pl.etaText(now),
+			)
+
+			if progress == int(100) {
+				return nil
+			}
+
+			if moved && pl.unstall() {
+				text := fmt.Sprintf(
+					unstallMsg,
+					strings.Title(p.job.BackupType),
+					progress,
+					pl.etaText(now),
+				)
+				p.log.Infof("%s", text)
+				p.notify(notifyer.Info, text)
+			}
+			stalled = fmt.Errorf(
+				"it stays at %d%% for %s",
+				progress,
+				now.Sub(pl.moved).Round(time.Second),
+			)
+		}
+
+		if pl.stall(now) {
+			p.warn(stallMsg, p.job.BackupType, stalled)
+		}
+
+		select {
+		case <-ctx.Done():
+			return p.handleErr(errFollowMsg, p.job.BackupType, context.Cause(ctx))
+		case <-time.After(pl.next()):
+		}
+	}
+}
+
+/*
+lock acquires run lock of the job workspace and backup type. Lock is kept in
+the first storage, which supports shared locks, or in local data folder.
+Returned context is cancelled, if lock is lost
+
+Arguments:
+
+	ctx context.Context
+
+Returns:
+
+	*lock.Lock
+	context.Context
+	error
+*/
+func (p *Processor) lock(ctx context.Context) (*lock.Lock, context.Context, error) {
+	name := p.job.AtlassianWorkspace + "_" + p.job.BackupType + ".lock"
+	var backend lock.Backend = lock.NewFile(filepath.Join(p.dataDir, "locks", name))
+
+	for _, target := range p.job.Storages {
+		s, err := p.storage(target)
 		if err != nil {
-			p.handleErr(errFollowMsg, p.config.BackupType, err)
+			continue
 		}
-		logger.Info.Printf(
-			"Current backup %s progress is: %d%%\n",
-			p.config.BackupType,
-			progress,
+		if l, ok := s.(storage.Locker); ok {
+			backend = l.Lock(path.Join(target.Prefix, "locks", name))
+			break
+		}
+	}
+
+	return lock.Acquire(ctx, backend, p.job.Name, p.job.LockTtl)
+}
+
+// unlock releases run lock, even if run is cancelled
+func (p *Processor) unlock(l *lock.Lock) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := l.Release(ctx); err != nil {
+		p.log.Warningf("%v\n", err)
+	}
+}
+
+/*
+runState returns interrupted run of the job to resume or new run
+
+Arguments:
+
+	downloadOnly bool
+
+Returns: *runstate.Run
+*/
+func (p *Processor) runState(downloadOnly bool) *runstate.Run {
+	r, err := runstate.Load(p.dataDir, p.job.Name)
+	if err != nil {
+		p.log.Warningf("%v, new run is started\n", err)
+	}
+
+	if r.Resumable() && r.DownloadOnly == downloadOnly {
+		p.log.Infof(
+			"Resuming %s run, which was interrupted in %s phase\n",
+			p.job.Name,
+			r.Phase,
 		)
+		return r
+	}
 
-		if progress == int(100) {
-			break
+	return runstate.New(p.dataDir, p.job.Name, downloadOnly)
+}
+
+/*
+setPhase saves run state in phase. Failure is logged only, because it doesn't
+affect current run
+
+Arguments:
+
+	r *runstate.Run
+	phase runstate.Phase
+*/
+func (p *Processor) setPhase(r *runstate.Run, phase runstate.Phase) {
+	if err := r.Set(phase); err != nil {
+		p.log.Warningf("%v\n", err)
+	}
+}
+
+/*
+finish saves the run result and appends it to run history. Cancelled run
+keeps its phase to be resumed
+
+Arguments:
+
+	r *runstate.Run
+	e error: run error
+*/
+func (p *Processor) finish(r *runstate.Run, e error) {
+	var err error
+	switch {
+	case e == nil:
+		err = r.Set(runstate.Done)
+	case errors.Is(e, context.Canceled):
+		err = r.Save()
+	default:
+		err = r.Fail(e)
+	}
+	if err != nil {
+		p.log.Warningf("%v\n", err)
+	}
+
+	p.record(r, e)
+}
+
+/*
+record appends the run result to run history
+
+Arguments:
+
+	r *runstate.Run
+	e error: run error
+*/
+func (p *Processor) record(r *runstate.Run, e error) {
+	rec := &history.Record{
+		RunId:        r.Id,
+		Job:          p.job.Name,
+		Workspace:    p.job.AtlassianWorkspace,
+		BackupType:   p.job.BackupType,
+		DownloadOnly: r.DownloadOnly,
+		Started:      r.Started,
+		Finished:     time.Now(),
+		Outcome:      history.Success,
+		TaskId:       r.TaskId,
+	}
+
+	switch {
+	case e == nil:
+	case errors.Is(e, context.Canceled):
+		rec.Outcome, rec.FailedPhase = history.Cancelled, p.phase
+	default:
+		rec.Outcome, rec.FailedPhase = history.Failure, p.phase
+		rec.Error = e.Error()
+	}
+
+	for _, t := range r.Targets {
+		rec.Targets = append(rec.Targets, history.Target{
+			Storage:   t.Type,
+			Object:    t.Object,
+			SizeBytes: t.Bytes,
+			Saved:     t.Saved,
+		})
+		if t.Saved {
+			rec.SizeBytes = t.Bytes
 		}
+	}
 
-		time.Sleep(time.Minute)
+	if err := history.Append(p.dataDir, rec); err != nil {
+		p.log.Warningf("%v\n", err)
 	}
+}
 
-	logger.Info.Printf(
-		"%s cloud backup success. Downloading backup file to %s storage...\n",
-		strings.Title(p.config.BackupType),
-		p.config.StorageType,
-	)
+/*
+created returns backup file creation time from Last-Modified header of
+download URL or zero time, if it's unknown
+
+Arguments:
+
+	ctx context.Context
+	file *http.Request
 
-	fileUrl, err := b.File()
+Returns: time.Time
+*/
+func (p *Processor) created(ctx context.Context, file *http.Request) time.Time {
+	header, err := utils.Head(ctx, p.retryPolicy(), file.URL, file.Header)
 	if err != nil {
-		p.handleErr(errGetUrlMsg, p.config.BackupType, err)
+		p.log.Warningf("Can't get backup file creation time: %v\n", err)
+		return time.Time{}
 	}
 
-	s, err := p.storage()
+	t, err := http.ParseTime(header.Get("Last-Modified"))
 	if err != nil {
-		p.handleErr(errInitStorage, p.config.StorageType, err)
+		return time.Time{}
+	}
+	return t
+}
+
+// createdText formats backup creation time for messages
+func createdText(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Format(time.RFC3339)
+}
+
+/*
+preflight creates notifyers and storages and checks storages availability
+before cloud backup is started, so misconfiguration is found before hours
+of Atlassian backup work
+
+Arguments:
+
+	ctx context.Context
+
+Returns:
+
+	[]storage.Storage: storages in job targets order
+	error
+*/
+func (p *Processor) preflight(ctx context.Context) ([]storage.Storage, error) {
+	if _, err := p.notifyer(); err != nil {
+		p.log.Errorf("Can't create notifyer object: %v\n", err)
+		return nil, utils.Wrap("can't create notifyer object", err)
+	}
+
+	storages := make([]storage.Storage, 0, len(p.job.Storages))
+
+	for _, target := range p.job.Storages {
+		s, err := p.storage(target)
+		if err != nil {
+			return nil, p.handleErr(errInitStorage, target.Type, err)
+		}
+
+		if c, ok := s.(storage.Checker); ok {
+			if err := c.Check(ctx); err != nil {
+				return nil, p.handleErr(errPreflight, target.Type, err)
+			}
+		}
+
+		storages = append(storages, s)
+	}
+
+	return storages, nil
+}
+
+/*
+Check finds the latest saved backup in storage and notifies, if it's older
+than configured max age or there are no backups at all. Used as dead man's
+switch for backup runs. Overdue backup is notified and returned as error
+
+Arguments:
+
+	ctx context.Context
+
+Returns: error
+*/
+func (p *Processor) Check(ctx context.Context) error {
+	for _, target := range p.job.Storages {
+		if err := p.check(ctx, target); err != nil {
+			return err
+		}
 	}
 
-	size, err := s.Save(fileUrl, p.obj())
+	n, err := p.notifyer()
+	if err == nil {
+		n.Key = p.overdueKey()
+		err = n.Resolve(fmt.Sprintf(
+			"%s backup is up to date",
+			strings.Title(p.job.BackupType),
+		))
+	}
 	if err != nil {
-		p.handleErr(errSaveMsg, p.config.StorageType, err)
+		p.log.Warningf("%v\n", err)
 	}
 
-	n, _ := slack.New()
-	n.Send(fmt.Sprintf(
-		"Backup %s successfully saved! Backup size is: %s",
-		strings.Title(p.config.BackupType),
-		size,
-	),
+	return nil
+}
+
+/*
+check finds the latest saved backup in storage target and handles error, if
+it's overdue
+
+Arguments:
+
+	ctx context.Context
+	target config.Storage
+
+Returns: error
+*/
+func (p *Processor) check(ctx context.Context, target config.Storage) error {
+	s, err := p.storage(target)
+	if err != nil {
+		return p.handleCheckErr(errInitStorage, target.Type, err)
+	}
+
+	l, ok := s.(storage.Lister)
+	if !ok {
+		return p.handleCheckErr(
+			errListMsg,
+			p.job.BackupType,
+			fmt.Errorf("%s storage doesn't support listing", target.Type),
+		)
+	}
+
+	objects, err := l.List(ctx, p.objPrefix(target))
+	if err != nil {
+		return p.handleCheckErr(errListMsg, p.job.BackupType, err)
+	}
+
+	latest := storage.Latest(objects)
+	if latest == nil {
+		return p.handleCheckErr(
+			errOverdueMsg,
+			p.job.BackupType,
+			fmt.Errorf("no backups found in %s storage", target.Type),
+		)
+	}
+
+	age := time.Since(latest.Modified).Truncate(time.Minute)
+	if age > p.job.MaxAge {
+		return p.handleCheckErr(
+			errOverdueMsg,
+			p.job.BackupType,
+			fmt.Errorf(
+				"the latest backup %s was saved %s ago (max age is %s)",
+				latest.Name,
+				age,
+				p.job.MaxAge,
+			),
+		)
+	}
+
+	p.log.Infof(
+		"The latest %s backup %s was saved %s ago, size is %s\n",
+		p.job.BackupType,
+		latest.Name,
+		age,
+		utils.NiceSize(latest.Size),
 	)
 
-	logger.Info.Printf(
-		"Backup %s successfully saved! Backup size is: %s",
-		strings.Title(p.config.BackupType),
-		size,
+	return nil
+}
+
+/*
+retain removes backups, expired by job retention policy, from storage.
+Failure is not fatal, it's only notified as warning
+
+Arguments:
+
+	ctx context.Context
+	target config.Storage
+	s storage.Storage
+*/
+func (p *Processor) retain(
+	ctx context.Context,
+	target config.Storage,
+	s storage.Storage,
+) {
+	if p.job.Retention.Keep == 0 && p.job.Retention.MaxAge == 0 {
+		return
+	}
+
+	l, lOk := s.(storage.Lister)
+	r, rOk := s.(storage.Remover)
+	if !lOk || !rOk {
+		p.log.Warningf(
+			"%s storage doesn't support retention\n",
+			strings.Title(target.Type),
+		)
+		return
+	}
+
+	objects, err := l.List(ctx, p.objPrefix(target))
+	if err != nil {
+		p.warn(errRetainMsg, target.Type, err)
+		return
+	}
+
+	expired := storage.Expired(
+		objects,
+		p.job.Retention.Keep,
+		p.job.Retention.MaxAge,
 	)
+
+	for _, o := range expired {
+		if err := r.Remove(ctx, o.Name); err != nil {
+			p.warn(errRetainMsg, target.Type, err)
+			return
+		}
+		p.log.Infof("Expired backup %s is removed\n", o.Name)
+	}
 }
 
 /*
@@ -127,45 +961,70 @@ backup.Backup interface
 Returns: backup.Backup
 */
 func (p *Processor) backup() backup.Backup {
-	switch p.config.BackupType {
+	// Atlassian URL is checked by config validation
+	base, err := url.Parse(p.job.AtlassianUrl)
+	if err != nil {
+		panic("Incorrect Atlassian URL parameter")
+	}
+
+	switch p.job.BackupType {
 	case "jira":
 		return jira.New(
-			p.config.AtlassianAccount,
-			p.config.AtlassianWorkspace,
-			p.config.AtlassianToken,
+			p.job.AtlassianAccount,
+			base,
+			p.job.AtlassianToken,
+			p.retryPolicy(),
 		)
 	case "confluence":
 		return confluence.New(
-			p.config.AtlassianAccount,
-			p.config.AtlassianWorkspace,
-			p.config.AtlassianToken,
+			p.job.AtlassianAccount,
+			base,
+			p.job.AtlassianToken,
+			p.retryPolicy(),
 		)
 	default:
 		panic("Unsupported backup type parameter")
 	}
 }
 
+// retryPolicy returns Atlassian API retry policy of the job
+func (p *Processor) retryPolicy() utils.RetryPolicy {
+	return utils.RetryPolicy(p.job.Retry)
+}
+
+// timeouts returns backup file saving timeouts of the job
+func (p *Processor) timeouts() storage.Timeouts {
+	return storage.Timeouts{
+		Download: p.job.Timeouts.Download,
+		Upload:   p.job.Timeouts.Upload,
+	}
+}
+
 /*
-storage parse application config and create object, which implements
+storage parse storage target config and create object, which implements
 storage.Storage interface. Return error if failure
 
+Arguments:
+
+	target config.Storage
+
 Returns:
 
 	s storage.Storage
 	err error
 */
-func (p *Processor) storage() (s storage.Storage, err error) {
-	switch p.config.StorageType {
+func (p *Processor) storage(target config.Storage) (s storage.Storage, err error) {
+	switch target.Type {
 
 	case "gs":
-		s, err := gs.New()
+		s, err := gs.New(target.Bucket, target.Credentials, p.timeouts())
 		if err != nil {
 			return nil, err
 		}
 		return s, nil
 
 	case "local":
-		s, err := local.New()
+		s, err := local.New(target.Folder, p.timeouts())
 		if err != nil {
 			return nil, err
 		}
@@ -176,78 +1035,269 @@ func (p *Processor) storage() (s storage.Storage, err error) {
 }
 
 /*
-notifyer parse application config and create object, which implements
-notifyer.Notifyer interface. Return error if failure
+notifyer parse application config and create object, which routes
+notifications to every configured notifyer according to its minimal severity.
+Return error if failure
 
 Returns:
 
-	n notifyer.Notifyer
+	n *notifyer.Router
 	err error
 */
-func (p *Processor) notifyer() (n notifyer.Notifyer, err error) {
-	switch p.config.NotifyType {
+func (p *Processor) notifyer() (n *notifyer.Router, err error) {
+	n = notifyer.NewRouter(p.alertKey())
 
-	case "slack":
-		s, err := slack.New()
+	for _, c := range p.job.Notifiers {
+		severity, err := notifyer.ParseSeverity(c.MinSeverity)
 		if err != nil {
 			return nil, err
 		}
-		return s, nil
 
+		nt, err := newNotifyer(c)
+		if err != nil {
+			return nil, err
+		}
+
+		n.Add(notifyer.Route{
+			Name:        c.Type,
+			Notifyer:    nt,
+			MinSeverity: severity,
+		})
+	}
+
+	return n, nil
+}
+
+/*
+newNotifyer creates notifyer of notification channel config. Return error if
+failure
+
+Arguments:
+
+	c config.Notifier
+
+Returns:
+
+	notifyer.Notifyer
+	error
+*/
+func newNotifyer(c config.Notifier) (notifyer.Notifyer, error) {
+	switch c.Type {
+	case "slack":
+		return slack.New(c.WebhookUrl)
+	case "pagerduty":
+		return pagerduty.New(c.RoutingKey, c.EventsUrl)
+	case "opsgenie":
+		return opsgenie.New(c.ApiKey, c.ApiUrl, c.Priority)
 	default:
 		panic("Unsupported notify type parameter")
 	}
 }
 
 /*
-obj set backup file path or blob with filename
+notify send message to configured notifyers. Notification failure is not
+fatal, it's only written to log
+
+Arguments:
+
+	s notifyer.Severity
+	text string
+*/
+func (p *Processor) notify(s notifyer.Severity, text string) {
+	n, err := p.notifyer()
+	if err != nil {
+		p.log.Warningf("Can't create notifyer object: %v\n", err)
+		return
+	}
+
+	if err := n.Notify(s, text); err != nil {
+		p.log.Warningf("%v\n", err)
+	}
+}
+
+/*
+warn write warning message to log and notify
+
+Arguments:
+
+	msg string: warning message template
+	ph string: placeholder
+	e error
+*/
+func (p *Processor) warn(msg, ph string, e error) {
+	p.log.Warningf(msg, strings.Title(ph), e)
+	p.notify(notifyer.Warning, fmt.Sprintf(msg, strings.Title(ph), e))
+}
+
+/*
+resolve close alerts, opened by previous failed runs. Failure is not fatal,
+it's only written to log
+
+Arguments:
+
+	text string: resolution note
+*/
+func (p *Processor) resolve(text string) {
+	n, err := p.notifyer()
+	if err != nil {
+		p.log.Warningf("Can't create notifyer object: %v\n", err)
+		return
+	}
+
+	if err := n.Resolve(text); err != nil {
+		p.log.Warningf("%v\n", err)
+	}
+}
+
+/*
+alertKey returns stable alert deduplication key for workspace and backup type
+
+Returns: string
+*/
+func (p *Processor) alertKey() string {
+	return fmt.Sprintf(
+		"atlassian_backup/%s/%s",
+		p.job.AtlassianWorkspace,
+		p.job.BackupType,
+	)
+}
+
+/*
+overdueKey returns alert deduplication key for overdue backup check
 
 Returns: string
 */
-func (p *Processor) obj() string {
-	fName := fmt.Sprintf(
+func (p *Processor) overdueKey() string {
+	return p.alertKey() + "/overdue"
+}
+
+/*
+ping report run event to heartbeat monitoring, if it's configured. Failure
+is not fatal, it's only written to log
+
+Arguments:
+
+	e heartbeat.Event
+	text string
+*/
+func (p *Processor) ping(e heartbeat.Event, text string) {
+	if p.job.HeartbeatUrl == "" {
+		return
+	}
+
+	if err := heartbeat.Ping(p.job.HeartbeatUrl, e, text); err != nil {
+		p.log.Warningf("%v\n", err)
+	}
+}
+
+/*
+fileName set backup file name with timestamp of backup creation, so the same
+cloud backup is saved under the same name. Current time is used, if creation
+time is unknown
+
+Arguments:
+
+	created time.Time
+
+Returns: string
+*/
+func (p *Processor) fileName(created time.Time) string {
+	timestamp := utils.Timestamp()
+	if !created.IsZero() {
+		timestamp = created.Local().Format("2006_01_02_15_04")
+	}
+
+	return fmt.Sprintf(
 		"%s_%s_%s.tar.gz",
-		p.config.BackupType,
+		p.job.BackupType,
 		"cloud",
-		utils.Timestamp(),
+		timestamp,
 	)
+}
 
-	name := filepath.Join(
-		strings.Title(p.config.BackupType),
-		"Cloud",
-		fName,
-	)
+/*
+objPrefix returns backup files folder or blobs prefix in storage target.
+Prefix includes workspace, so jobs of different workspaces may share storage
+target, and retention and check of one job don't see backups of another one
 
-	return name
+Arguments:
+
+	target config.Storage
+
+Returns: string
+*/
+func (p *Processor) objPrefix(target config.Storage) string {
+	return filepath.Join(
+		target.Prefix,
+		p.job.AtlassianWorkspace,
+		strings.Title(p.job.BackupType),
+		"Cloud",
+	) + "/"
 }
 
 /*
-handleErr write error message to log and notify to some notifyer
+handleErr write error message to log, notify to some notifyer and returns
+error for caller. Cancellation is notified as warning, not as failure
 
 Arguments:
 
 	msg string: error message template
 	ph string: placeholder
 	e error
+
+Returns: error
 */
-func (p *Processor) handleErr(msg, ph string, e error) {
+func (p *Processor) handleErr(msg, ph string, e error) error {
+	severity := notifyer.Error
+	if errors.Is(e, context.Canceled) {
+		severity = notifyer.Warning
+		msg, ph = cancelMsg, p.job.BackupType
+	} else {
+		metrics.Failed(p.job, p.phase)
+	}
+
+	text := utils.Redact(fmt.Sprintf(msg, strings.Title(ph), e))
+
 	n, err := p.notifyer()
 	if err != nil {
-		logger.Error.Fatalf(
-			"Can't create %s notifyer object: %v",
-			p.config.NotifyType,
-			err,
-		)
+		p.log.Errorf("Can't create notifyer object: %v\n", err)
+	} else if err := n.Notify(severity, text); err != nil {
+		p.log.Errorf("%v\n", err)
 	}
 
-	if err := n.Send(fmt.Sprintf(msg, strings.Title(ph), e)); err != nil {
-		logger.Error.Fatalf(
-			"Can't send notification to %s: %v\n",
-			strings.Title(p.config.NotifyType),
-			err,
-		)
+	p.ping(heartbeat.Fail, text)
+
+	p.log.Errorf("%s", text)
+
+	return &failure{text: strings.TrimSuffix(text, "\n"), err: e}
+}
+
+/*
+handleCheckErr write check error message to log, open overdue alert and
+returns error for caller
+
+Arguments:
+
+	msg string: error message template
+	ph string: placeholder
+	e error
+
+Returns: error
+*/
+func (p *Processor) handleCheckErr(msg, ph string, e error) error {
+	text := fmt.Sprintf(msg, strings.Title(ph), e)
+
+	n, err := p.notifyer()
+	if err != nil {
+		p.log.Errorf("Can't create notifyer object: %v\n", err)
+	} else {
+		n.Key = p.overdueKey()
+		if err := n.Notify(notifyer.Error, text); err != nil {
+			p.log.Errorf("%v\n", err)
+		}
 	}
 
-	logger.Error.Fatalf(msg, strings.Title(ph), e)
+	p.log.Errorf("%s", text)
 
+	return &failure{text: strings.TrimSuffix(text, "\n"), err: e}
 }
@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"atlassian_backup/config"
+	"atlassian_backup/lib/utils"
+	"atlassian_backup/logger"
+	"atlassian_backup/notifyer"
+	"atlassian_backup/runstate"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Result presents outcome of one job run for summary notification
+type Result struct {
+	Job  *config.Job
+	Err  error
+	Took time.Duration
+}
+
+/*
+Summarize sends one summary of all jobs runs, e.g. of nightly run of all
+workspaces, to notification channels of the jobs. Every channel gets the
+summary once, even if it's shared by several jobs. Alerters are skipped,
+because failures are already alerted by every job. Summary is warning, if
+some job failed. Notification failure is only written to log
+
+Arguments:
+
+	dataDir string: application data folder with run states
+	results []Result
+*/
+func Summarize(dataDir string, results []Result) {
+	failed := 0
+	lines := make([]string, 0, len(results)+1)
+
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			lines = append(lines, fmt.Sprintf(
+				"FAILED %s: %s",
+				r.Job.Name,
+				firstLine(r.Err.Error()),
+			))
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			"OK %s: %s, took %s",
+			r.Job.Name,
+			savedSize(dataDir, r.Job),
+			r.Took.Round(time.Second),
+		))
+	}
+
+	severity := notifyer.Info
+	if failed != 0 {
+		severity = notifyer.Warning
+	}
+	text := strings.Join(append([]string{fmt.Sprintf(
+		"Backup summary: %d of %d job(s) succeeded",
+		len(results)-failed,
+		len(results),
+	)}, lines...), "\n")
+
+	logger.Infof("%s\n", text)
+
+	sent := make(map[config.Notifier]bool)
+	for _, r := range results {
+		for _, c := range r.Job.Notifiers {
+			if sent[c] {
+				continue
+			}
+			sent[c] = true
+
+			minSeverity, err := notifyer.ParseSeverity(c.MinSeverity)
+			if err != nil || severity < minSeverity {
+				continue
+			}
+
+			n, err := newNotifyer(c)
+			if err != nil {
+				logger.Warningf("Can't create notifyer object: %v\n", err)
+				continue
+			}
+			if _, ok := n.(notifyer.Alerter); ok {
+				continue
+			}
+
+			if err := n.Send(utils.Redact(text)); err != nil {
+				logger.Warningf("Can't send backup summary: %s: %v\n", c.Type, err)
+			}
+		}
+	}
+}
+
+// savedSize returns size of backup file saved by the last run of job
+func savedSize(dataDir string, job *config.Job) string {
+	r, err := runstate.Load(dataDir, job.Name)
+	if err != nil || r == nil {
+		return "saved"
+	}
+	for _, t := range r.Targets {
+		if t.Saved {
+			return "saved " + t.Size
+		}
+	}
+	return "saved"
+}
+
+// firstLine returns the first line of text without trailing spaces
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return strings.TrimSpace(line)
+}
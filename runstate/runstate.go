@@ -0,0 +1,239 @@
+/*
+Package runstate implements persistent state of backup job runs.
+
+State of the current run of every job is saved to file in application data
+folder after each pipeline phase, so run interrupted by crash or restart is
+resumed from the interrupted phase instead of starting new cloud backup,
+which Atlassian allows only once per 48 hours.
+*/
+package runstate
+
+import (
+	"atlassian_backup/lib/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Phase presents backup pipeline phase
+type Phase string
+
+const (
+	Started     Phase = "started"
+	Following   Phase = "following"
+	Downloading Phase = "downloading"
+	Done        Phase = "done"
+	Failed      Phase = "failed"
+)
+
+const (
+	// resumeWindow limits age of run, which can be resumed
+	resumeWindow = 48 * time.Hour
+	runsDir      = "runs"
+)
+
+/*
+A Target presents backup file in one storage target. Size is set, when file
+is saved
+*/
+type Target struct {
+	Type   string `json:"type"`
+	Object string `json:"object"`
+	Size   string `json:"size,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	Saved  bool   `json:"saved"`
+}
+
+/*
+A Run presents state of one job run. Id is random run ID, which is kept when
+run is resumed, it's added to log lines of the run. TaskId is Atlassian task
+of the run, resumed run follows it instead of the last task of the site.
+Accepted is time, when Atlassian accepted cloud backup run or reported
+backup in progress, it's zero for download only run and run failed before
+backup start. FileUrl is backup file download URL without credentials, it's
+for information only
+*/
+type Run struct {
+	path string
+
+	Id           string    `json:"id"`
+	Job          string    `json:"job"`
+	DownloadOnly bool      `json:"downloadOnly,omitempty"`
+	Phase        Phase     `json:"phase"`
+	TaskId       string    `json:"taskId,omitempty"`
+	Accepted     time.Time `json:"accepted,omitempty"`
+	FileUrl      string    `json:"fileUrl,omitempty"`
+	Created      time.Time `json:"created,omitempty"`
+	Targets      []Target  `json:"targets,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Started      time.Time `json:"started"`
+	Updated      time.Time `json:"updated"`
+}
+
+/*
+New returns new run of job in started phase. Run isn't saved until Save or
+Set is called
+
+Arguments:
+
+	dataDir string: application data folder
+	job string: job name
+	downloadOnly bool
+
+Returns: *Run
+*/
+func New(dataDir, job string, downloadOnly bool) *Run {
+	now := time.Now()
+	return &Run{
+		path:         path(dataDir, job),
+		Id:           newId(),
+		Job:          job,
+		DownloadOnly: downloadOnly,
+		Phase:        Started,
+		Started:      now,
+		Updated:      now,
+	}
+}
+
+/*
+Load reads the last run state of job. Returns nil run, if job has no saved
+state
+
+Arguments:
+
+	dataDir string: application data folder
+	job string: job name
+
+Returns:
+
+	*Run
+	error
+*/
+func Load(dataDir, job string) (r *Run, err error) {
+	defer func() { err = utils.WrapIfErr("can't load run state", err) }()
+
+	p := path(dataDir, job)
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r = &Run{path: p}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	if r.Id == "" {
+		r.Id = newId()
+	}
+
+	return r, nil
+}
+
+/*
+Resumable reports whether run was interrupted and is recent enough to be
+resumed
+
+Returns: bool
+*/
+func (r *Run) Resumable() bool {
+	if r == nil || r.Phase == Done || r.Phase == Failed {
+		return false
+	}
+	return time.Since(r.Started) < resumeWindow
+}
+
+/*
+Set changes run phase and saves state. Returns error if failure
+
+Arguments:
+
+	phase Phase
+
+Returns: error
+*/
+func (r *Run) Set(phase Phase) error {
+	r.Phase = phase
+	return r.Save()
+}
+
+/*
+Fail sets failed phase with error message and saves state. Returns error if
+failure
+
+Arguments:
+
+	e error
+
+Returns: error
+*/
+func (r *Run) Fail(e error) error {
+	r.Error = e.Error()
+	return r.Set(Failed)
+}
+
+/*
+Target returns state of backup file in i-th storage target of job. Target is
+added, if it doesn't exist or storage type is changed
+
+Arguments:
+
+	i int: storage target index
+	typ string: storage type
+	object string: backup file name in storage
+
+Returns: *Target
+*/
+func (r *Run) Target(i int, typ, object string) *Target {
+	for len(r.Targets) <= i {
+		r.Targets = append(r.Targets, Target{})
+	}
+
+	if r.Targets[i].Type != typ || r.Targets[i].Object == "" {
+		r.Targets[i] = Target{Type: typ, Object: object}
+	}
+	return &r.Targets[i]
+}
+
+/*
+Save writes run state to file atomically. Returns error if failure
+
+Returns: error
+*/
+func (r *Run) Save() (err error) {
+	defer func() { err = utils.WrapIfErr("can't save run state", err) }()
+
+	r.Updated = time.Now()
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(r.path, data)
+}
+
+// newId returns random run ID
+func newId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// path returns state file path of job
+func path(dataDir, job string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(job)
+	return filepath.Join(dataDir, runsDir, name+".json")
+}
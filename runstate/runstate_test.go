@@ -0,0 +1,118 @@
+package runstate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	r := New(dir, "example/jira", false)
+	r.TaskId = "10001"
+	r.Accepted = time.Now().Round(time.Second)
+	r.Target(0, "local", "example/Jira/Cloud/jira_cloud_2024_01_02_03_04.tar.gz").Saved = true
+	if err := r.Set(Following); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+
+	// Job name doesn't make nested folders
+	if _, err := os.Stat(filepath.Join(dir, runsDir, "example_jira.json")); err != nil {
+		t.Errorf("state file: %v", err)
+	}
+
+	loaded, err := Load(dir, "example/jira")
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Id != r.Id || loaded.Job != "example/jira" || loaded.Phase != Following ||
+		loaded.TaskId != "10001" || !loaded.Accepted.Equal(r.Accepted) {
+		t.Errorf("loaded run = %+v, want %+v", loaded, r)
+	}
+	if len(loaded.Targets) != 1 || !loaded.Targets[0].Saved {
+		t.Errorf("loaded targets = %+v", loaded.Targets)
+	}
+
+	// Loaded run is saved to the same file
+	if err := loaded.Fail(errors.New("download failed")); err != nil {
+		t.Fatalf("Fail error: %v", err)
+	}
+	failed, err := Load(dir, "example/jira")
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if failed.Phase != Failed || failed.Error != "download failed" {
+		t.Errorf("failed run = %+v", failed)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	r, err := Load(t.TempDir(), "example-jira")
+	if r != nil || err != nil {
+		t.Errorf("Load = %+v, %v, want nil run", r, err)
+	}
+	if r.Resumable() {
+		t.Error("nil run is resumable")
+	}
+}
+
+func TestLoadCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, runsDir), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path(dir, "example-jira"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(dir, "example-jira"); err == nil {
+		t.Error("Load of corrupted state: no error")
+	}
+}
+
+func TestResumable(t *testing.T) {
+	for _, tc := range []struct {
+		phase   Phase
+		started time.Duration
+		want    bool
+	}{
+		{Started, time.Minute, true},
+		{Following, 47 * time.Hour, true},
+		{Downloading, time.Hour, true},
+		{Following, 49 * time.Hour, false},
+		{Downloading, resumeWindow, false},
+		{Done, time.Minute, false},
+		{Failed, time.Minute, false},
+	} {
+		r := New(t.TempDir(), "example-jira", false)
+		r.Phase = tc.phase
+		r.Started = time.Now().Add(-tc.started)
+
+		if got := r.Resumable(); got != tc.want {
+			t.Errorf("Resumable of %s run started %s ago = %v, want %v", tc.phase, tc.started, got, tc.want)
+		}
+	}
+}
+
+func TestTarget(t *testing.T) {
+	r := New(t.TempDir(), "example-jira", false)
+
+	second := r.Target(1, "gs", "b")
+	second.Saved = true
+	if len(r.Targets) != 2 {
+		t.Fatalf("targets = %+v, want 2", r.Targets)
+	}
+
+	// Resumed run keeps saved target and its object name
+	if got := r.Target(1, "gs", "other"); !got.Saved || got.Object != "b" {
+		t.Errorf("target of resumed run = %+v", got)
+	}
+
+	// Changed storage type means new target
+	if got := r.Target(1, "local", "c"); got.Saved || got.Object != "c" {
+		t.Errorf("target of changed storage = %+v", got)
+	}
+}
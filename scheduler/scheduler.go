@@ -0,0 +1,434 @@
+/*
+Package scheduler implements daemon mode: jobs are run by their cron
+schedules while the process is running.
+
+Atlassian allows to run cloud backup only once per 48 hours, so scheduled
+runs, which are too close to previous run of the same job, are skipped. Job
+run is skipped too, if previous run of the job is still in progress. Time
+of the last run of every job is saved to state file, so run missed while
+daemon was stopped is started once on daemon start. Run, which was
+interrupted by daemon stop, is resumed on daemon start regardless of the
+frequency limit, because it doesn't start new cloud backup.
+
+Time, when Atlassian accepted the last backup of every job, is saved as the
+last run time after run is finished, so run, which failed before backup was
+started, e.g. by storage preflight failure, doesn't use up the frequency
+limit.
+
+Jobs, including jobs without schedule, may be also run on demand by Trigger,
+e.g. by control API. On-demand run isn't limited by backup frequency, because
+it's explicitly requested.
+
+Number of concurrently run jobs is limited by configured concurrency, job
+waits for free slot, if limit is reached.
+
+When daemon is stopped, running jobs are cancelled and daemon waits for them
+to finish cleanup.
+*/
+package scheduler
+
+import (
+	"atlassian_backup/config"
+	"atlassian_backup/logger"
+	"atlassian_backup/runstate"
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// minInterval is the Atlassian backup frequency limit
+	minInterval = 48 * time.Hour
+	stateFile   = "schedule.json"
+)
+
+// A Runner runs job once and returns error if failure
+type Runner func(ctx context.Context, job *config.Job) error
+
+// A Scheduler runs jobs by their schedules
+type Scheduler struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	entries []*entry
+	run     Runner
+	state   *state
+	dataDir string
+	// ctx is the daemon context, which on-demand runs are bound to
+	ctx context.Context
+	// slots limits number of concurrent runs, nil means no limit
+	slots chan struct{}
+}
+
+// A JobStatus presents schedule state of job
+type JobStatus struct {
+	Name    string
+	Running bool
+	// Next is zero for on-demand only job
+	Next time.Time
+}
+
+// Trigger errors
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	ErrRunning    = errors.New("job is already running")
+	ErrStopped    = errors.New("daemon is not running")
+)
+
+// entry presents job, schedule is nil for on-demand only job
+type entry struct {
+	job      *config.Job
+	schedule cron.Schedule
+	next     time.Time
+	running  bool
+	resume   bool
+}
+
+/*
+New returns new Scheduler for jobs or error if there are no scheduled jobs
+or state file can't be read. Jobs without schedule are run on demand only
+
+Arguments:
+
+	c *config.Config
+	run Runner
+
+Returns:
+
+	*Scheduler
+	error
+*/
+func New(c *config.Config, run Runner) (*Scheduler, error) {
+	st, err := loadState(filepath.Join(c.DataDir, stateFile))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{
+		run:     run,
+		state:   st,
+		dataDir: c.DataDir,
+	}
+	if c.Concurrency > 0 {
+		s.slots = make(chan struct{}, c.Concurrency)
+	}
+
+	for i := range c.Jobs {
+		job := &c.Jobs[i]
+		if job.Schedule == "" {
+			logger.Warningf(
+				"Job %s has no schedule, it's run on demand only\n",
+				job.Name,
+			)
+			s.entries = append(s.entries, &entry{job: job})
+			continue
+		}
+
+		schedule, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		s.entries = append(s.entries, &entry{
+			job:      job,
+			schedule: schedule,
+		})
+	}
+
+	if !s.scheduled() {
+		return nil, errors.New("no scheduled jobs found")
+	}
+
+	return s, nil
+}
+
+/*
+Run starts jobs by their schedules. Missed runs are started immediately.
+Returns, when context is done and all running jobs are finished
+
+Arguments:
+
+	ctx context.Context
+*/
+func (s *Scheduler) Run(ctx context.Context) {
+	now := time.Now()
+
+	// Entries and state are shared with Trigger, Jobs and finished runs
+	s.mu.Lock()
+	s.ctx = ctx
+	for _, e := range s.entries {
+		if e.schedule == nil {
+			continue
+		}
+		e.next = e.schedule.Next(now)
+
+		r, err := runstate.Load(s.dataDir, e.job.Name)
+		if err != nil {
+			logger.Warningf("%v\n", err)
+		}
+		if r.Resumable() && !r.DownloadOnly {
+			logger.Infof("Job %s run was interrupted, resuming\n", e.job.Name)
+			e.next = now
+			e.resume = true
+			continue
+		}
+
+		last := s.state.lastRun(e.job.Name)
+		if !last.IsZero() && !e.schedule.Next(last).After(now) {
+			logger.Infof("Job %s missed scheduled run, catching up\n", e.job.Name)
+			e.next = now
+			continue
+		}
+
+		logger.Infof(
+			"Job %s is scheduled at %s\n",
+			e.job.Name,
+			e.next.Format(time.RFC3339),
+		)
+	}
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		next := s.earliest()
+		s.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Infof("Daemon is stopping, waiting for running jobs")
+			s.wg.Wait()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		s.mu.Lock()
+		for _, e := range s.entries {
+			if e.schedule == nil || e.next.After(now) {
+				continue
+			}
+			s.trigger(ctx, e, now)
+			e.next = e.schedule.Next(now)
+			logger.Infof(
+				"Job %s is scheduled at %s\n",
+				e.job.Name,
+				e.next.Format(time.RFC3339),
+			)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// scheduled reports whether some job has schedule
+func (s *Scheduler) scheduled() bool {
+	for _, e := range s.entries {
+		if e.schedule != nil {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+earliest returns time of the next run of any scheduled job. Must be called
+with locked mutex
+
+Returns: time.Time
+*/
+func (s *Scheduler) earliest() time.Time {
+	var t time.Time
+	for _, e := range s.entries {
+		if e.schedule == nil {
+			continue
+		}
+		if t.IsZero() || e.next.Before(t) {
+			t = e.next
+		}
+	}
+	return t
+}
+
+/*
+Trigger starts job run on demand in background. Returns ErrUnknownJob,
+ErrRunning or ErrStopped, if run can't be started
+
+Arguments:
+
+	name string: job name
+
+Returns: error
+*/
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx == nil || s.ctx.Err() != nil {
+		return ErrStopped
+	}
+
+	e := s.entry(name)
+	if e == nil {
+		return ErrUnknownJob
+	}
+	if e.running {
+		return ErrRunning
+	}
+
+	logger.Infof("Job %s is triggered on demand\n", name)
+	s.start(s.ctx, e)
+
+	return nil
+}
+
+/*
+Jobs returns schedule state of all jobs
+
+Returns: []JobStatus
+*/
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]JobStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		jobs = append(jobs, JobStatus{
+			Name:    e.job.Name,
+			Running: e.running,
+			Next:    e.next,
+		})
+	}
+	return jobs
+}
+
+/*
+Running reports whether job is running
+
+Arguments:
+
+	name string: job name
+
+Returns: bool
+*/
+func (s *Scheduler) Running(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(name)
+	return e != nil && e.running
+}
+
+// entry returns entry of job or nil, if job is unknown
+func (s *Scheduler) entry(name string) *entry {
+	for _, e := range s.entries {
+		if e.job.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+/*
+trigger starts job run in background, if job isn't running and Atlassian
+frequency limit allows it. Must be called with locked mutex
+
+Arguments:
+
+	ctx context.Context
+	e *entry
+	now time.Time
+*/
+func (s *Scheduler) trigger(ctx context.Context, e *entry, now time.Time) {
+	if e.running {
+		logger.Warningf(
+			"Job %s is still running, scheduled run is skipped\n",
+			e.job.Name,
+		)
+		return
+	}
+
+	if e.resume {
+		// Resumed run is the same run, so frequency limit isn't checked
+		e.resume = false
+	} else if last := s.state.lastRun(e.job.Name); now.Sub(last) < minInterval {
+		logger.Warningf(
+			"Job %s was run at %s, Atlassian allows one backup per %s, scheduled run is skipped\n",
+			e.job.Name,
+			last.Format(time.RFC3339),
+			minInterval,
+		)
+		return
+	}
+
+	s.start(ctx, e)
+}
+
+/*
+record saves time, when Atlassian accepted backup of the last job run, as the
+last run time. Run, which failed before backup was accepted, and download
+only run aren't recorded. Must be called with locked mutex
+
+Arguments:
+
+	name string: job name
+*/
+func (s *Scheduler) record(name string) {
+	r, err := runstate.Load(s.dataDir, name)
+	if err != nil {
+		logger.Warningf("%v\n", err)
+		return
+	}
+	if r == nil || r.DownloadOnly || !r.Accepted.After(s.state.lastRun(name)) {
+		return
+	}
+
+	if err := s.state.setLastRun(name, r.Accepted); err != nil {
+		logger.Warningf("Can't save scheduler state: %v\n", err)
+	}
+}
+
+/*
+start runs job in background and marks it running until run is finished.
+Job waits for free slot, if number of concurrent runs is limited. Must be
+called with locked mutex
+
+Arguments:
+
+	ctx context.Context
+	e *entry
+*/
+func (s *Scheduler) start(ctx context.Context, e *entry) {
+	e.running = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			e.running = false
+			s.record(e.job.Name)
+			s.mu.Unlock()
+		}()
+
+		if s.slots != nil {
+			select {
+			case s.slots <- struct{}{}:
+				defer func() { <-s.slots }()
+			case <-ctx.Done():
+				logger.Warningf("Job %s is cancelled before start\n", e.job.Name)
+				return
+			}
+		}
+
+		logger.Infof("Job %s is started\n", e.job.Name)
+		if err := s.run(ctx, e.job); err != nil {
+			logger.Errorf("Job %s failed: %v\n", e.job.Name, err)
+		} else {
+			logger.Infof("Job %s is finished\n", e.job.Name)
+		}
+	}()
+}
@@ -0,0 +1,235 @@
+package scheduler
+
+import (
+	"atlassian_backup/config"
+	"atlassian_backup/runstate"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// yearly is schedule, which doesn't fire while test is running
+const yearly = "0 0 1 1 *"
+
+/*
+newScheduler starts scheduler of one job with run function and returns it
+with job name. Scheduler is stopped, when test is finished
+*/
+func newScheduler(t *testing.T, dataDir string, run Runner) (*Scheduler, string) {
+	t.Helper()
+
+	c := &config.Config{
+		DataDir: dataDir,
+		Jobs:    []config.Job{{Name: "example-jira", Schedule: yearly}},
+	}
+	s, err := New(c, run)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Trigger is available, when Run is started
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		started := s.ctx != nil
+		s.mu.Unlock()
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("scheduler isn't started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return s, c.Jobs[0].Name
+}
+
+// runOnce triggers job and waits for its run to finish
+func runOnce(t *testing.T, s *Scheduler, name string) {
+	t.Helper()
+
+	if err := s.Trigger(name); err != nil {
+		t.Fatalf("Trigger error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Running(name) {
+		if time.Now().After(deadline) {
+			t.Fatal("job is still running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// lastRun returns the last run time of job from scheduler state file
+func lastRun(t *testing.T, s *Scheduler, name string) time.Time {
+	t.Helper()
+
+	st, err := loadState(filepath.Join(s.dataDir, stateFile))
+	if err != nil {
+		t.Fatalf("loadState error: %v", err)
+	}
+	return st.lastRun(name)
+}
+
+func TestFailedBeforeAcceptIsNotRecorded(t *testing.T) {
+	dir := t.TempDir()
+	s, name := newScheduler(t, dir, func(ctx context.Context, job *config.Job) error {
+		// e.g. storage preflight failure, backup isn't started
+		r := runstate.New(dir, job.Name, false)
+		if err := r.Fail(errors.New("bucket doesn't exist")); err != nil {
+			t.Error(err)
+		}
+		return errors.New("bucket doesn't exist")
+	})
+
+	runOnce(t, s, name)
+
+	if last := lastRun(t, s, name); !last.IsZero() {
+		t.Errorf("last run = %s, want zero", last)
+	}
+}
+
+func TestAcceptedRunIsRecorded(t *testing.T) {
+	accepted := time.Now().Add(-time.Minute).Round(time.Second)
+
+	dir := t.TempDir()
+	s, name := newScheduler(t, dir, func(ctx context.Context, job *config.Job) error {
+		// Backup is accepted, but download fails
+		r := runstate.New(dir, job.Name, false)
+		r.Accepted = accepted
+		if err := r.Fail(errors.New("download failed")); err != nil {
+			t.Error(err)
+		}
+		return errors.New("download failed")
+	})
+
+	runOnce(t, s, name)
+
+	if last := lastRun(t, s, name); !last.Equal(accepted) {
+		t.Errorf("last run = %s, want %s", last, accepted)
+	}
+}
+
+func TestDownloadOnlyRunIsNotRecorded(t *testing.T) {
+	dir := t.TempDir()
+	s, name := newScheduler(t, dir, func(ctx context.Context, job *config.Job) error {
+		r := runstate.New(dir, job.Name, true)
+		r.Accepted = time.Now()
+		return r.Set(runstate.Done)
+	})
+
+	runOnce(t, s, name)
+
+	if last := lastRun(t, s, name); !last.IsZero() {
+		t.Errorf("last run = %s, want zero", last)
+	}
+}
+
+func TestTriggerErrors(t *testing.T) {
+	release := make(chan struct{})
+	dir := t.TempDir()
+	s, name := newScheduler(t, dir, func(ctx context.Context, job *config.Job) error {
+		<-release
+		return nil
+	})
+
+	if err := s.Trigger("unknown"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Trigger(unknown) = %v, want ErrUnknownJob", err)
+	}
+
+	if err := s.Trigger(name); err != nil {
+		t.Fatalf("Trigger error: %v", err)
+	}
+	if err := s.Trigger(name); !errors.Is(err, ErrRunning) {
+		t.Errorf("second Trigger = %v, want ErrRunning", err)
+	}
+	close(release)
+}
+
+func TestMissedRunIsCaughtUp(t *testing.T) {
+	dir := t.TempDir()
+	st, err := loadState(filepath.Join(dir, stateFile))
+	if err != nil {
+		t.Fatalf("loadState error: %v", err)
+	}
+	if err := st.setLastRun("example-jira", time.Now().AddDate(-2, 0, 0)); err != nil {
+		t.Fatalf("setLastRun error: %v", err)
+	}
+
+	ran := make(chan struct{})
+	c := &config.Config{
+		DataDir: dir,
+		Jobs:    []config.Job{{Name: "example-jira", Schedule: yearly}},
+	}
+	s, err := New(c, func(ctx context.Context, job *config.Job) error {
+		close(ran)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	// Jobs is read concurrently with scheduling, e.g. by control API
+	stop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = s.Jobs()
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-polled
+		cancel()
+		<-done
+	}()
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("missed run isn't started")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jobs := s.Jobs()
+		if len(jobs) != 1 || jobs[0].Name != "example-jira" {
+			t.Fatalf("Jobs = %v", jobs)
+		}
+		if !jobs[0].Running && jobs[0].Next.After(time.Now()) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job isn't rescheduled: %v", jobs)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
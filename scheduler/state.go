@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"atlassian_backup/lib/utils"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// A state presents scheduler state file: the last run time of every job
+type state struct {
+	path string
+	Jobs map[string]jobState `json:"jobs"`
+}
+
+type jobState struct {
+	LastRun time.Time `json:"lastRun"`
+}
+
+/*
+loadState reads scheduler state from file. Missing file means empty state
+
+Arguments:
+
+	path string
+
+Returns:
+
+	*state
+	error
+*/
+func loadState(path string) (st *state, err error) {
+	defer func() { err = utils.WrapIfErr("can't load scheduler state", err) }()
+
+	st = &state{
+		path: path,
+		Jobs: make(map[string]jobState),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, err
+	}
+	if st.Jobs == nil {
+		st.Jobs = make(map[string]jobState)
+	}
+
+	return st, nil
+}
+
+// lastRun returns the last run time of job or zero time
+func (st *state) lastRun(job string) time.Time {
+	return st.Jobs[job].LastRun
+}
+
+// setLastRun sets the last run time of job and saves state to file
+func (st *state) setLastRun(job string, t time.Time) error {
+	st.Jobs[job] = jobState{LastRun: t}
+	return st.save()
+}
+
+// save writes state to file atomically
+func (st *state) save() error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(st.path, data)
+}
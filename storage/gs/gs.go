@@ -2,51 +2,69 @@
 Package gs implements function for saving file, which can be downloaded
 from URL, to Google Cloud Storage.
 
-Required environment
+Google Storage client uses service account JSON key, if it's given to New,
+or application default credentials, e.g. from environment:
 
 	GOOGLE_APPLICATION_CREDENTIALS: path to google service-account json file
-	GS_BUCKET_NAME: Google Storage bucket name
 */
 package gs
 
 import (
 	"atlassian_backup/lib/utils"
+	atlstorage "atlassian_backup/storage"
+	"atlassian_backup/tracing"
 	"context"
 	"errors"
 	"io"
 	"net/http"
-	"net/url"
-	"os"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 )
 
+const listTimeout = 5 * time.Minute
+
 /*
 A GoogleStorage is representation Google Cloud Storage for store backup files.
 Implements storage.Storage interface.
 */
 type GoogleStorage struct {
-	bucketName string
+	bucketName  string
+	credentials []byte
+	timeouts    atlstorage.Timeouts
 }
 
 /*
-New returns new GoogleStorage object or error if failure. Get google storage
-bucket name from environment: GS_BUCKET_NAME
+New returns new GoogleStorage object or error if failure.
+
+Arguments:
+
+	bucket string: Google Storage bucket name
+	credentials string: service account JSON key, empty means application
+	default credentials
+	timeouts storage.Timeouts: backup file saving timeouts
 
 Returns:
 
 	*GoogleStorage
 	error
 */
-func New() (*GoogleStorage, error) {
-	bucket, ok := os.LookupEnv("GS_BUCKET_NAME")
-	if !ok {
-		return nil, errors.New("GS bucker is not specified")
+func New(
+	bucket, credentials string,
+	timeouts atlstorage.Timeouts,
+) (*GoogleStorage, error) {
+	if bucket == "" {
+		return nil, errors.New("GS bucket is not specified")
 	}
 
 	return &GoogleStorage{
-		bucketName: bucket,
+		bucketName:  bucket,
+		credentials: []byte(credentials),
+		timeouts:    timeouts,
 	}, nil
 }
 
@@ -54,54 +72,189 @@ func New() (*GoogleStorage, error) {
 Save download backup file from URL and save it to Google Storage. Returns
 backup file size or error (if failure).
 
+Upload is aborted without creating object, if context is done, download
+fails or download or upload timeout is exceeded.
+
 Arguments:
 
-	downloadUrl *url.URL
+	ctx context.Context
+	src *http.Request: backup file download request
 	obj string
 
 Returns:
 
-	size string
+	size int64: backup file size in bytes
 	err error
 */
 func (gs *GoogleStorage) Save(
-	downloadUrl *url.URL,
+	ctx context.Context,
+	src *http.Request,
 	obj string,
-) (size string, err error) {
+) (size int64, err error) {
 	defer func() { err = utils.WrapIfErr("can't save backup to storage", err) }()
 
+	ctx, timer := utils.NewPhaseTimer(ctx)
+	defer func() { err = utils.TimeoutCause(ctx, err) }()
+	defer timer.Stop()
+	timer.Start("download", gs.timeouts.Download)
+
 	client := http.Client{
 		Timeout: 0,
 	}
 
-	req, err := http.NewRequest(http.MethodGet, downloadUrl.String(), nil)
-	if err != nil {
-		return "", nil
+	_, span := tracing.Start(ctx, "backup.download")
+	resp, err := client.Do(src.Clone(ctx))
+	if err == nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		defer func() { _ = resp.Body.Close() }()
+		err = utils.CheckResponse(resp)
 	}
-
-	resp, err := client.Do(req)
+	tracing.End(span, err)
 	if err != nil {
-		return "", nil
+		return 0, err
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Hour)
+	// Backup file is streamed, so upload span includes body download
+	_, span = tracing.Start(ctx, "backup.upload")
+	defer func() {
+		span.SetAttributes(attribute.Int64("bytes", size))
+		tracing.End(span, err)
+	}()
+
+	// Cancelling writer context aborts upload, so partial object isn't created
+	wCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	gsClient, err := storage.NewClient(ctx)
+	gsClient, err := gs.client(wCtx)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	defer func() { _ = gsClient.Close() }()
 
 	object := gsClient.Bucket(gs.bucketName).Object(obj)
-	writer := object.NewWriter(ctx)
-	defer func() { _ = writer.Close() }()
+	writer := object.NewWriter(wCtx)
 
 	nBytes, err := io.Copy(writer, resp.Body)
 	if err != nil {
-		return "", err
+		cancel()
+		_ = writer.Close()
+		return 0, err
+	}
+
+	timer.Start("upload", gs.timeouts.Upload)
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+
+	return nBytes, nil
+}
+
+/*
+List returns backup files, which names start with prefix, or error if failure.
+
+Arguments:
+
+	ctx context.Context
+	prefix string
+
+Returns:
+
+	objects []storage.Object
+	err error
+*/
+func (gs *GoogleStorage) List(
+	ctx context.Context,
+	prefix string,
+) (objects []atlstorage.Object, err error) {
+	defer func() { err = utils.WrapIfErr("can't list storage objects", err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	gsClient, err := gs.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = gsClient.Close() }()
+
+	it := gsClient.Bucket(gs.bucketName).Objects(ctx, &storage.Query{
+		Prefix: prefix,
+	})
+
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, atlstorage.Object{
+			Name:     attrs.Name,
+			Size:     attrs.Size,
+			Modified: attrs.Updated,
+		})
+	}
+
+	return objects, nil
+}
+
+/*
+Remove deletes backup file from Google Storage. Returns error if failure.
+
+Arguments:
+
+	ctx context.Context
+	name string
+
+Returns: error
+*/
+func (gs *GoogleStorage) Remove(ctx context.Context, name string) (err error) {
+	defer func() { err = utils.WrapIfErr("can't remove storage object", err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	gsClient, err := gs.client(ctx)
+	if err != nil {
+		return err
 	}
+	defer func() { _ = gsClient.Close() }()
+
+	return gsClient.Bucket(gs.bucketName).Object(name).Delete(ctx)
+}
 
-	return utils.NiceSize(nBytes), nil
+/*
+Check verifies, that Google Storage bucket exists and is accessible. Returns
+error if failure.
+
+Arguments:
+
+	ctx context.Context
+
+Returns: error
+*/
+func (gs *GoogleStorage) Check(ctx context.Context) (err error) {
+	defer func() { err = utils.WrapIfErr("can't access storage bucket", err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	gsClient, err := gs.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = gsClient.Close() }()
+
+	_, err = gsClient.Bucket(gs.bucketName).Attrs(ctx)
+	return err
+}
+
+// client creates Google Storage client with configured credentials
+func (gs *GoogleStorage) client(ctx context.Context) (*storage.Client, error) {
+	if len(gs.credentials) == 0 {
+		return storage.NewClient(ctx)
+	}
+	return storage.NewClient(ctx, option.WithCredentialsJSON(gs.credentials))
 }
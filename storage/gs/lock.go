@@ -0,0 +1,133 @@
+package gs
+
+import (
+	"atlassian_backup/lock"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+/*
+An objectLock is lock Backend, which keeps lock record in Google Storage
+object. Object generation preconditions make changes atomic, so instances
+on different hosts can share the lock
+*/
+type objectLock struct {
+	gs   *GoogleStorage
+	name string
+}
+
+/*
+Lock returns lock Backend, which keeps lock record in bucket object
+
+Arguments:
+
+	name string: lock object name
+
+Returns: lock.Backend
+*/
+func (gs *GoogleStorage) Lock(name string) lock.Backend {
+	return &objectLock{gs: gs, name: name}
+}
+
+// Create writes lock object, if it doesn't exist
+func (o *objectLock) Create(ctx context.Context, data []byte) (int64, error) {
+	return o.write(ctx, data, storage.Conditions{DoesNotExist: true})
+}
+
+// Read returns lock object content and generation
+func (o *objectLock) Read(ctx context.Context) (data []byte, gen int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	client, err := o.gs.client(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = client.Close() }()
+
+	reader, err := client.Bucket(o.gs.bucketName).Object(o.name).NewReader(ctx)
+	if err != nil {
+		return nil, 0, lockErr(err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	data, err = io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return data, reader.Attrs.Generation, nil
+}
+
+// Replace rewrites lock object, if its generation matches
+func (o *objectLock) Replace(ctx context.Context, data []byte, gen int64) (int64, error) {
+	return o.write(ctx, data, storage.Conditions{GenerationMatch: gen})
+}
+
+// Delete removes lock object, if its generation matches
+func (o *objectLock) Delete(ctx context.Context, gen int64) error {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	client, err := o.gs.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	object := client.Bucket(o.gs.bucketName).Object(o.name)
+	err = object.If(storage.Conditions{GenerationMatch: gen}).Delete(ctx)
+	return lockErr(err)
+}
+
+// write writes lock object with precondition and returns its generation
+func (o *objectLock) write(
+	ctx context.Context,
+	data []byte,
+	cond storage.Conditions,
+) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	client, err := o.gs.client(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = client.Close() }()
+
+	writer := client.Bucket(o.gs.bucketName).Object(o.name).If(cond).NewWriter(ctx)
+	writer.ContentType = "application/json"
+
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return 0, lockErr(err)
+	}
+	if err := writer.Close(); err != nil {
+		return 0, lockErr(err)
+	}
+
+	return writer.Attrs().Generation, nil
+}
+
+// lockErr converts Google Storage errors to lock package errors
+func lockErr(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return lock.ErrNotExist
+	}
+
+	var e *googleapi.Error
+	if errors.As(err, &e) {
+		switch e.Code {
+		case http.StatusPreconditionFailed:
+			return lock.ErrLocked
+		case http.StatusNotFound:
+			return lock.ErrNotExist
+		}
+	}
+	return err
+}
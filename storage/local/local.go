@@ -1,21 +1,24 @@
 /*
 Package local implements function for saving file, which can be downloaded
 from URL, to local filesystem
-
-Required environment:
-
-	LOCAL_FOLDER:
 */
 package local
 
 import (
 	"atlassian_backup/lib/utils"
+	"atlassian_backup/storage"
+	"atlassian_backup/tracing"
+	"context"
 	"errors"
 	"io"
+	"io/fs"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
 
 /*
@@ -24,85 +27,225 @@ Implements storage.Storage interface
 */
 type LocalStorage struct {
 	LocalPath string
+	timeouts  storage.Timeouts
 }
 
 /*
-New returns new LocalStorage object or error if failure. Get local folder from
-environment: LOCAL_FOLDER
+New returns new LocalStorage object or error if failure.
+
+Arguments:
+
+	folder string: backups folder
+	timeouts storage.Timeouts: backup file saving timeouts
 
 Returns:
 
 	*LocalStorage
 	error
 */
-func New() (*LocalStorage, error) {
-	folder, ok := os.LookupEnv("LOCAL_FOLDER")
-	if !ok {
+func New(folder string, timeouts storage.Timeouts) (*LocalStorage, error) {
+	if folder == "" {
 		return nil, errors.New("Local folder is not specified")
 	}
 
 	return &LocalStorage{
 		LocalPath: folder,
+		timeouts:  timeouts,
 	}, nil
 }
 
 /*
 Save download backup file from URL and save if to local filesystem. Returns
-backup file size or error (if failure).
+backup file size or error (if failure). Partially written file is removed,
+if context is done, download fails or download or upload timeout is
+exceeded.
 
 Arguments:
 
-	downloadUrl *url.URL
+	ctx context.Context
+	src *http.Request: backup file download request
 	obj string
 
 Returns:
 
-	size string
+	size int64: backup file size in bytes
 	err error
 */
 func (ls *LocalStorage) Save(
-	downloadUrl *url.URL,
+	ctx context.Context,
+	src *http.Request,
 	obj string,
-) (size string, err error) {
+) (size int64, err error) {
 	defer func() {
 		err = utils.WrapIfErr("can't save backup to folder", err)
 	}()
 
+	ctx, timer := utils.NewPhaseTimer(ctx)
+	defer func() { err = utils.TimeoutCause(ctx, err) }()
+	defer timer.Stop()
+	timer.Start("download", ls.timeouts.Download)
+
 	client := http.Client{
 		Timeout: 0,
 	}
 
-	req, err := http.NewRequest(http.MethodGet, downloadUrl.String(), nil)
-	if err != nil {
-		return "", nil
+	_, span := tracing.Start(ctx, "backup.download")
+	resp, err := client.Do(src.Clone(ctx))
+	if err == nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		defer func() { _ = resp.Body.Close() }()
+		err = utils.CheckResponse(resp)
 	}
-
-	resp, err := client.Do(req)
+	tracing.End(span, err)
 	if err != nil {
-		return "", nil
+		return 0, err
 	}
-	defer func() { _ = resp.Body.Close() }()
+
+	// Backup file is streamed, so upload span includes body download
+	_, span = tracing.Start(ctx, "backup.upload")
+	defer func() {
+		span.SetAttributes(attribute.Int64("bytes", size))
+		tracing.End(span, err)
+	}()
 
 	filename := filepath.Join(ls.LocalPath, obj)
 
 	err = ifDirNotExists(filename)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0600)
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
-	defer func() { _ = file.Close() }()
+	defer func() {
+		_ = file.Close()
+		if err != nil {
+			_ = os.Remove(filename)
+		}
+	}()
 
 	nBytes, err := io.Copy(file, resp.Body)
 	if err != nil {
-		return "", err
+		return 0, err
+	}
+
+	// Sync isn't cancelled by context, so upload timeout is checked after it
+	timer.Start("upload", ls.timeouts.Upload)
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return nBytes, nil
+
+}
+
+/*
+List returns backup files, which paths relative to local folder start with
+prefix, or error if failure. Missing folder means no backups.
+
+Arguments:
+
+	ctx context.Context
+	prefix string
+
+Returns:
+
+	objects []storage.Object
+	err error
+*/
+func (ls *LocalStorage) List(
+	ctx context.Context,
+	prefix string,
+) (objects []storage.Object, err error) {
+	defer func() { err = utils.WrapIfErr("can't list backup files", err) }()
+
+	err = filepath.WalkDir(ls.LocalPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name, err := filepath.Rel(ls.LocalPath, path)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, storage.Object{
+			Name:     name,
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+/*
+Remove deletes backup file from local folder. Returns error if failure.
+
+Arguments:
+
+	ctx context.Context
+	name string: path relative to local folder
+
+Returns: error
+*/
+func (ls *LocalStorage) Remove(ctx context.Context, name string) error {
+	if err := os.Remove(filepath.Join(ls.LocalPath, name)); err != nil {
+		return utils.Wrap("can't remove backup file", err)
 	}
+	return nil
+}
 
-	return utils.NiceSize(nBytes), nil
+/*
+Check verifies, that local folder exists or can be created and it's
+writable. Returns error if failure.
+
+Arguments:
+
+	ctx context.Context
+
+Returns: error
+*/
+func (ls *LocalStorage) Check(ctx context.Context) (err error) {
+	defer func() { err = utils.WrapIfErr("can't write to backup folder", err) }()
+
+	if err := os.MkdirAll(ls.LocalPath, os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(ls.LocalPath, ".check_*")
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
 
+	return os.Remove(file.Name())
 }
 
 /*
@@ -1,15 +1,140 @@
 // Package storage include interface for describe backup storage
 package storage
 
-import "net/url"
+import (
+	"atlassian_backup/lock"
+	"context"
+	"net/http"
+	"sort"
+	"time"
+)
 
 /*
 A Storage presents backups storage object
 
 Methods:
 
-	Save(downloadUrl *url.URL, obj string) (size string, err error)
+	Save(ctx context.Context, src *http.Request, obj string) (size int64, err error)
 */
 type Storage interface {
-	Save(downloadUrl *url.URL, obj string) (size string, err error)
+	Save(ctx context.Context, src *http.Request, obj string) (size int64, err error)
+}
+
+/*
+A Lister presents storage, which can list saved backups
+
+Methods:
+
+	List(ctx context.Context, prefix string) (objects []Object, err error)
+*/
+type Lister interface {
+	List(ctx context.Context, prefix string) (objects []Object, err error)
+}
+
+/*
+A Remover presents storage, which can remove saved backups
+
+Methods:
+
+	Remove(ctx context.Context, name string) (err error)
+*/
+type Remover interface {
+	Remove(ctx context.Context, name string) (err error)
+}
+
+/*
+A Checker presents storage, which can check its availability before backup
+is started, e.g. bucket existence or folder write permission
+
+Methods:
+
+	Check(ctx context.Context) (err error)
+*/
+type Checker interface {
+	Check(ctx context.Context) (err error)
+}
+
+/*
+A Locker presents storage, which can keep run lock shared by application
+instances on different hosts
+
+Methods:
+
+	Lock(name string) (b lock.Backend)
+*/
+type Locker interface {
+	Lock(name string) (b lock.Backend)
+}
+
+/*
+A Timeouts presents limits of backup file saving phases: Download is
+streaming of backup file to storage, Upload is commit of saved file, e.g.
+GS object finalization. Zero means no limit
+*/
+type Timeouts struct {
+	Download time.Duration
+	Upload   time.Duration
+}
+
+// An Object presents saved backup file
+type Object struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+/*
+Latest returns the most recently modified object or nil if objects list is
+empty
+
+Arguments:
+
+	objects []Object
+
+Returns: *Object
+*/
+func Latest(objects []Object) *Object {
+	var latest *Object
+
+	for i := range objects {
+		if latest == nil || objects[i].Modified.After(latest.Modified) {
+			latest = &objects[i]
+		}
+	}
+
+	return latest
+}
+
+/*
+Expired returns objects, which should be removed by retention policy: all
+objects except keep latest ones and objects older than maxAge. The latest
+object is never expired. Zero keep or maxAge disables the rule.
+
+Arguments:
+
+	objects []Object
+	keep int
+	maxAge time.Duration
+
+Returns: []Object
+*/
+func Expired(objects []Object, keep int, maxAge time.Duration) []Object {
+	sorted := make([]Object, len(objects))
+	copy(sorted, objects)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Modified.After(sorted[j].Modified)
+	})
+
+	var expired []Object
+	for i, o := range sorted {
+		if i == 0 {
+			continue
+		}
+		if (keep > 0 && i >= keep) ||
+			(maxAge > 0 && time.Since(o.Modified) > maxAge) {
+			expired = append(expired, o)
+		}
+	}
+
+	return expired
 }
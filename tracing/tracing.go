@@ -0,0 +1,157 @@
+/*
+Package tracing implements OpenTelemetry tracing of backup pipeline.
+
+Spans are exported by OTLP over HTTP, if exporter endpoint is set by
+standard OpenTelemetry environment variables:
+
+	OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+	OTEL_EXPORTER_OTLP_HEADERS: e.g. authorization of tracing backend
+	OTEL_SERVICE_NAME: service name (default atlassian_backup)
+
+Otherwise spans aren't recorded.
+*/
+package tracing
+
+import (
+	"atlassian_backup/lib/utils"
+	"context"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "atlassian_backup"
+
+var (
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider
+)
+
+/*
+Init starts spans export, if OTLP exporter endpoint is configured. Returns
+error if exporter can't be created
+
+Arguments:
+
+	ctx context.Context
+
+Returns: error
+*/
+func Init(ctx context.Context) (err error) {
+	defer func() { err = utils.WrapIfErr("can't init tracing", err) }()
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" &&
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(serviceName),
+		),
+	)
+	if err != nil {
+		return err
+	}
+	// Service name from environment overrides the default one
+	envRes, err := resource.New(ctx, resource.WithFromEnv())
+	if err != nil {
+		return err
+	}
+	if res, err = resource.Merge(res, envRes); err != nil {
+		return err
+	}
+
+	Use(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	))
+	return nil
+}
+
+/*
+Use sets tracer provider, e.g. with in-memory exporter
+
+Arguments:
+
+	tp *sdktrace.TracerProvider
+*/
+func Use(tp *sdktrace.TracerProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	provider = tp
+	otel.SetTracerProvider(tp)
+}
+
+/*
+Shutdown exports remaining spans and stops export. Returns error if failure
+
+Arguments:
+
+	ctx context.Context
+
+Returns: error
+*/
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if provider == nil {
+		return nil
+	}
+	return utils.WrapIfErr("can't shutdown tracing", provider.Shutdown(ctx))
+}
+
+/*
+Start starts span, which is child of context span
+
+Arguments:
+
+	ctx context.Context
+	name string
+	attrs ...attribute.KeyValue
+
+Returns:
+
+	context.Context: context with started span
+	trace.Span
+*/
+func Start(
+	ctx context.Context,
+	name string,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	return otel.Tracer(serviceName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+/*
+End records error, if it isn't nil, and ends span
+
+Arguments:
+
+	span trace.Span
+	err error
+*/
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,137 @@
+package tracing_test
+
+import (
+	"atlassian_backup/backup/atlassiantest"
+	"atlassian_backup/config"
+	"atlassian_backup/processor"
+	"atlassian_backup/tracing"
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestProcessSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracing.Use(tp)
+	t.Cleanup(func() { _ = tracing.Shutdown(context.Background()) })
+
+	srv := atlassiantest.NewServer(atlassiantest.Scenario{
+		Progress: []int{30, 100},
+		Throttle: 1,
+	})
+	defer srv.Close()
+
+	job := &config.Job{
+		Name:               "example-jira",
+		AtlassianAccount:   atlassiantest.Account,
+		AtlassianWorkspace: "example",
+		AtlassianUrl:       srv.URL,
+		AtlassianToken:     atlassiantest.Token,
+		BackupType:         "jira",
+		Storages:           []config.Storage{{Type: "local", Folder: t.TempDir()}},
+		LockTtl:            time.Minute,
+		Retry: config.Retry{
+			MaxAttempts:  3,
+			InitialDelay: time.Millisecond,
+			MaxDelay:     time.Millisecond,
+		},
+		Poll: config.Poll{
+			InitialInterval: time.Millisecond,
+			MaxInterval:     time.Millisecond,
+		},
+	}
+
+	if err := processor.New(job, t.TempDir()).Process(context.Background()); err != nil {
+		t.Fatalf("Process error: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+
+	var root *tracetest.SpanStub
+	for i := range spans {
+		if spans[i].Name == "backup.run" {
+			if root != nil {
+				t.Fatal("several backup.run spans")
+			}
+			root = &spans[i]
+		}
+	}
+	if root == nil {
+		t.Fatal("no backup.run span")
+	}
+	if root.Parent.IsValid() {
+		t.Error("backup.run isn't root span")
+	}
+	if !hasAttr(root.Attributes, attribute.String("job", "example-jira")) {
+		t.Errorf("backup.run attributes = %v", root.Attributes)
+	}
+
+	children := make(map[string]bool)
+	for _, s := range spans {
+		if s.Parent.SpanID() == root.SpanContext.SpanID() {
+			children[s.Name] = true
+		}
+	}
+	for _, name := range []string{
+		"backup.trigger",
+		"backup.poll",
+		"backup.resolve_url",
+		"backup.save",
+		"backup.notify",
+	} {
+		if !children[name] {
+			t.Errorf("no %s child span of backup.run, children: %v", name, children)
+		}
+	}
+
+	// Throttled request is retried within one client span
+	retried := false
+	requests := 0
+	for _, s := range spans {
+		if s.SpanKind != trace.SpanKindClient {
+			continue
+		}
+		requests++
+
+		if s.Name != "HTTP GET" && s.Name != "HTTP POST" && s.Name != "HTTP HEAD" {
+			t.Errorf("client span name %q", s.Name)
+		}
+		if s.SpanContext.TraceID() != root.SpanContext.TraceID() {
+			t.Errorf("%s span isn't in backup.run trace", s.Name)
+		}
+
+		attempts, ok := attr(s.Attributes, "http.attempts")
+		if !ok {
+			t.Errorf("%s span has no http.attempts", s.Name)
+		}
+		if attempts.AsInt64() == 2 {
+			retried = true
+		}
+	}
+	if requests == 0 {
+		t.Error("no HTTP client spans")
+	}
+	if !retried {
+		t.Error("no client span with retried request")
+	}
+}
+
+func attr(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func hasAttr(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	v, ok := attr(attrs, want.Key)
+	return ok && v == want.Value
+}